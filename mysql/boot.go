@@ -8,8 +8,13 @@ package rkmysql
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	driver "github.com/go-sql-driver/mysql"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rookie-ninja/rk-db/mysql/plugins"
 	"github.com/rookie-ninja/rk-entry/v2/entry"
@@ -18,9 +23,17 @@ import (
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	gormLogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+	"gorm.io/plugin/dbresolver"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,6 +45,36 @@ func init() {
 
 const MySqlEntryType = "MySqlEntry"
 
+// ErrNotConnected is returned by GetDBE if connecting in lazy mode failed without error recorded
+var ErrNotConnected = errors.New("database is not connected yet")
+
+// ErrInterrupted is returned by Connect, GetDB and GetDBE in lazy mode once entry interrupted
+var ErrInterrupted = errors.New("entry is interrupted")
+
+// LazyConnectTimeout bounds connecting triggered by GetDB and GetDBE in lazy mode, use Connect to connect with own context
+const LazyConnectTimeout = 30 * time.Second
+
+const (
+	// TlsModeRequired encrypts connection and verifies server certificate and host name,
+	// CA in CertEntry will be used if provided, otherwise, system CA pool will be used
+	TlsModeRequired = "required"
+	// TlsModeVerifyCA encrypts connection and verifies server certificate with CA in CertEntry without host name
+	TlsModeVerifyCA = "verify-ca"
+	// TlsModeSkipVerify encrypts connection without verifying server certificate
+	TlsModeSkipVerify = "skip-verify"
+)
+
+const (
+	// ProtocolTcp connects to MySQL with host:port
+	ProtocolTcp = "tcp"
+	// ProtocolUnix connects to MySQL with unix domain socket file
+	ProtocolUnix = "unix"
+	// DefaultTcpAddr is used if addr is missing with tcp protocol
+	DefaultTcpAddr = "localhost:3306"
+	// DefaultUnixAddr is used if addr is missing with unix protocol
+	DefaultUnixAddr = "/var/run/mysqld/mysqld.sock"
+)
+
 // BootMySQL
 // MySql entry boot config which reflects to YAML config
 type BootMySQL struct {
@@ -45,16 +88,83 @@ type BootMySQLE struct {
 	Domain      string `yaml:"domain" json:"domain"`
 	User        string `yaml:"user" json:"user"`
 	Pass        string `yaml:"pass" json:"pass"`
+	PassFile    string `yaml:"passFile" json:"passFile"`
 	Protocol    string `yaml:"protocol" json:"protocol"`
 	Addr        string `yaml:"addr" json:"addr"`
-	Database    []struct {
+	Lazy        bool   `yaml:"lazy" json:"lazy"`
+	CertEntry   string `yaml:"certEntry" json:"certEntry"`
+	TlsMode     string `yaml:"tlsMode" json:"tlsMode"`
+	HealthCheck struct {
+		Enabled    bool `yaml:"enabled" json:"enabled"`
+		IntervalMs int  `yaml:"intervalMs" json:"intervalMs"`
+		TimeoutMs  int  `yaml:"timeoutMs" json:"timeoutMs"`
+	} `yaml:"healthCheck" json:"healthCheck"`
+	Retry struct {
+		MaxAttempts   int `yaml:"maxAttempts" json:"maxAttempts"`
+		IntervalMs    int `yaml:"intervalMs" json:"intervalMs"`
+		MaxIntervalMs int `yaml:"maxIntervalMs" json:"maxIntervalMs"`
+	} `yaml:"retry" json:"retry"`
+	// ReconnectGraceMs is the duration old connections kept open after Reconnect
+	ReconnectGraceMs int `yaml:"reconnectGraceMs" json:"reconnectGraceMs"`
+	// nodes tried in order, overrides addr
+	Addrs []string `yaml:"addrs" json:"addrs"`
+	// abort bootstrap or log a warning if server is older, like 8.0 or 8.0.13
+	MinServerVersion        string `yaml:"minServerVersion" json:"minServerVersion"`
+	MinServerVersionOnError string `yaml:"minServerVersionOnError" json:"minServerVersionOnError"`
+	// default timeouts of databases, converted into timeout, readTimeout and writeTimeout params of DSN
+	DialTimeoutMs  int `yaml:"dialTimeoutMs" json:"dialTimeoutMs"`
+	ReadTimeoutMs  int `yaml:"readTimeoutMs" json:"readTimeoutMs"`
+	WriteTimeoutMs int `yaml:"writeTimeoutMs" json:"writeTimeoutMs"`
+	Database       []struct {
 		Name       string   `yaml:"name" json:"name"`
 		Params     []string `yaml:"params" json:"params"`
 		DryRun     bool     `yaml:"dryRun" json:"dryRun"`
 		AutoCreate bool     `yaml:"autoCreate" json:"autoCreate"`
-		Plugins    struct {
+		// complete DSN passed to driver verbatim, addr, user, pass, protocol and params are ignored
+		Dsn      string `yaml:"dsn" json:"-"`
+		AdminDsn string `yaml:"adminDsn" json:"-"`
+		// connection pool, Go defaults will be used if not positive
+		MaxIdleConn       int `yaml:"maxIdleConn" json:"maxIdleConn"`
+		MaxOpenConn       int `yaml:"maxOpenConn" json:"maxOpenConn"`
+		ConnMaxLifetimeMs int `yaml:"connMaxLifetimeMs" json:"connMaxLifetimeMs"`
+		ConnMaxIdleTimeMs int `yaml:"connMaxIdleTimeMs" json:"connMaxIdleTimeMs"`
+		// overrides timeouts of entry
+		DialTimeoutMs  int `yaml:"dialTimeoutMs" json:"dialTimeoutMs"`
+		ReadTimeoutMs  int `yaml:"readTimeoutMs" json:"readTimeoutMs"`
+		WriteTimeoutMs int `yaml:"writeTimeoutMs" json:"writeTimeoutMs"`
+		// converted into interpolateParams and multiStatements params of DSN
+		InterpolateParams bool `yaml:"interpolateParams" json:"interpolateParams"`
+		MultiStatements   bool `yaml:"multiStatements" json:"multiStatements"`
+		Replicas          struct {
+			Addrs  []string `yaml:"addrs" json:"addrs"`
+			Policy string   `yaml:"policy" json:"policy"`
+		} `yaml:"replicas" json:"replicas"`
+		// executed only if database created by autoCreate
+		SeedScript  string   `yaml:"seedScript" json:"seedScript"`
+		SeedSQL     []string `yaml:"seedSQL" json:"seedSQL"`
+		SeedOnError string   `yaml:"seedOnError" json:"seedOnError"`
+		// converted into loc param of DSN, gorm.Config.NowFunc returns UTC time if storeUTC enabled
+		TimeZone string `yaml:"timeZone" json:"timeZone"`
+		StoreUTC bool   `yaml:"storeUTC" json:"storeUTC"`
+		// .sql files in dir will be applied in order of file name
+		Migrations struct {
+			Dir   string `yaml:"dir" json:"dir"`
+			Table string `yaml:"table" json:"table"`
+		} `yaml:"migrations" json:"migrations"`
+		Gorm GormConfig `yaml:"gorm" json:"gorm"`
+		// overrides logger of entry, fields not provided inherit from entry
+		Logger struct {
+			Level                     string `json:"level" yaml:"level"`
+			SlowThresholdMs           int    `json:"slowThresholdMs" yaml:"slowThresholdMs"`
+			IgnoreRecordNotFoundError *bool  `json:"ignoreRecordNotFoundError" yaml:"ignoreRecordNotFoundError"`
+		} `json:"logger" yaml:"logger"`
+		Plugins struct {
 			Prom plugins.PromConfig `yaml:"prom"`
 		} `yaml:"plugins" json:"plugins"`
+		// authentication and compatibility params of DSN, driver defaults are used if not provided
+		AllowNativePasswords    *bool `yaml:"allowNativePasswords" json:"allowNativePasswords"`
+		AllowCleartextPasswords *bool `yaml:"allowCleartextPasswords" json:"allowCleartextPasswords"`
+		Compress                *bool `yaml:"compress" json:"compress"`
 	} `yaml:"database" json:"database"`
 	Logger struct {
 		Entry                     string   `json:"entry" yaml:"entry"`
@@ -66,6 +176,17 @@ type BootMySQLE struct {
 	} `json:"logger" yaml:"logger"`
 }
 
+// GormConfig is subset of gorm.Config which could be configured in YAML
+type GormConfig struct {
+	PrepareStmt                              bool   `yaml:"prepareStmt" json:"prepareStmt"`
+	SkipDefaultTransaction                   bool   `yaml:"skipDefaultTransaction" json:"skipDefaultTransaction"`
+	CreateBatchSize                          int    `yaml:"createBatchSize" json:"createBatchSize"`
+	TablePrefix                              string `yaml:"tablePrefix" json:"tablePrefix"`
+	SingularTable                            bool   `yaml:"singularTable" json:"singularTable"`
+	DisableForeignKeyConstraintWhenMigrating bool   `yaml:"disableForeignKeyConstraintWhenMigrating" json:"disableForeignKeyConstraintWhenMigrating"`
+	TranslateError                           bool   `yaml:"translateError" json:"translateError"`
+}
+
 // MySqlEntry will init gorm.DB or SqlMock with provided arguments
 type MySqlEntry struct {
 	entryName        string                  `yaml:"entryName" yaml:"entryName"`
@@ -76,17 +197,117 @@ type MySqlEntry struct {
 	logger           *Logger                 `yaml:"-" json:"-"`
 	Protocol         string                  `yaml:"protocol" json:"protocol"`
 	Addr             string                  `yaml:"addr" json:"addr"`
+	Addrs            []string                `yaml:"addrs" json:"addrs"`
+	ServerVersion    string                  `yaml:"serverVersion" json:"serverVersion"`
 	innerDbList      []*databaseInner        `yaml:"-" json:"-"`
 	GormDbMap        map[string]*gorm.DB     `yaml:"-" json:"-"`
 	GormConfigMap    map[string]*gorm.Config `yaml:"-" json:"-"`
+
+	replicaDbMap        map[string][]*replicaDb
+	quitChannel         chan struct{}
+	passFile            string
+	healthCheckEnabled  bool
+	healthCheckInterval time.Duration
+	healthCheckTimeout  time.Duration
+	certEntry           *rkentry.CertEntry
+	tlsMode             string
+	tlsEnabled          bool
+	tlsConfigName       string
+	retryMaxAttempts    int
+	retryInterval       time.Duration
+	retryMaxInterval    time.Duration
+	timeouts            timeouts
+	lazy                bool
+	reconnectGrace      time.Duration
+	minServerVersion    string
+	minServerVersionErr bool
+	// credLock guards User and pass which could be updated by UpdateCredentials, passwords in raw DSNs,
+	// and Addr which is switched to active node if Addrs provided
+	credLock   sync.RWMutex
+	dsnSecrets []string
+	// active node changes counted by from and to, nil if less than two nodes
+	nodeChanges *prometheus.CounterVec
+	// lock guards GormDbMap, replicaDbMap and connected, connectLock serializes connecting
+	lock        sync.RWMutex
+	connectLock sync.Mutex
+	connected   bool
+	connectErr  error
+	// Interrupt could be called multiple times, resources are released only once
+	interruptOnce sync.Once
 }
 
 type databaseInner struct {
-	name       string
-	dryRun     bool
-	autoCreate bool
-	params     []string
-	plugins    []gorm.Plugin
+	name            string
+	dryRun          bool
+	autoCreate      bool
+	params          []string
+	rawParams       bool
+	dsn             string
+	adminDsn        string
+	plugins         []gorm.Plugin
+	maxIdleConn     int
+	maxOpenConn     int
+	connMaxLifetime time.Duration
+	connMaxIdleTime time.Duration
+	replicaAddrs    []string
+	replicaPolicy   string
+	gormOptions     GormConfig
+	gormConfig      *gorm.Config
+	timeouts        timeouts
+	statements      statementParams
+	compat          CompatParams
+	timeZone        string
+	storeUTC        bool
+	migrations      *migrations
+	seed            *seedOptions
+	loggerOverride  DatabaseLogger
+	logger          *Logger
+	dialector       gorm.Dialector
+}
+
+// DatabaseLogger overrides logger settings of entry for a database, zero values inherit from entry
+type DatabaseLogger struct {
+	// Level is one of info, warn, error and silent
+	Level                     string
+	SlowThreshold             time.Duration
+	IgnoreRecordNotFoundError *bool
+}
+
+// CompatParams are typed authentication and compatibility params of DSN, nil fields keep driver defaults
+type CompatParams struct {
+	AllowNativePasswords    *bool
+	AllowCleartextPasswords *bool
+	Compress                *bool
+}
+
+// statementParams are boolean params of DSN which change the way statements sent to server
+type statementParams struct {
+	interpolateParams bool
+	multiStatements   bool
+}
+
+// timeouts of DSN, zero means not configured
+type timeouts struct {
+	dial  time.Duration
+	read  time.Duration
+	write time.Duration
+}
+
+// replicaDb is a read replica of database which is routed by dbresolver
+type replicaDb struct {
+	addr string
+	db   *sql.DB
+}
+
+// roundRobinPolicy resolves replicas one by one
+type roundRobinPolicy struct {
+	counter uint64
+}
+
+// Resolve implements dbresolver.Policy
+func (p *roundRobinPolicy) Resolve(connPools []gorm.ConnPool) gorm.ConnPool {
+	index := (atomic.AddUint64(&p.counter, 1) - 1) % uint64(len(connPools))
+	return connPools[index]
 }
 
 // Option for MySqlEntry
@@ -124,7 +345,16 @@ func WithPass(pass string) Option {
 	}
 }
 
-// WithProtocol provide protocol
+// WithPassFile provide file which contains password, trimmed contents will override password provided by WithPass()
+func WithPassFile(path string) Option {
+	return func(m *MySqlEntry) {
+		if len(path) > 0 {
+			m.passFile = toAbsPath(path)[0]
+		}
+	}
+}
+
+// WithProtocol provide protocol, one of tcp and unix
 func WithProtocol(protocol string) Option {
 	return func(m *MySqlEntry) {
 		if len(protocol) > 0 {
@@ -133,7 +363,7 @@ func WithProtocol(protocol string) Option {
 	}
 }
 
-// WithAddr provide address
+// WithAddr provide address, host:port for tcp or path of socket file for unix
 func WithAddr(addr string) Option {
 	return func(m *MySqlEntry) {
 		if len(addr) > 0 {
@@ -142,6 +372,17 @@ func WithAddr(addr string) Option {
 	}
 }
 
+// WithAddrs provide addresses of nodes in preferred order, which overrides address provided by WithAddr.
+// Connecting tries nodes in order, and health checker fails back to earlier nodes once they are reachable.
+func WithAddrs(addrs ...string) Option {
+	return func(m *MySqlEntry) {
+		if len(addrs) > 0 {
+			m.Addrs = addrs
+			m.Addr = addrs[0]
+		}
+	}
+}
+
 // WithDatabase provide database
 func WithDatabase(name string, dryRun, autoCreate bool, params ...string) Option {
 	return func(m *MySqlEntry) {
@@ -164,6 +405,7 @@ func WithDatabase(name string, dryRun, autoCreate bool, params ...string) Option
 				"loc=Local")
 		} else {
 			innerDb.params = append(innerDb.params, params...)
+			innerDb.rawParams = true
 		}
 
 		m.innerDbList = append(m.innerDbList, innerDb)
@@ -184,6 +426,263 @@ func WithPlugin(name string, plugin gorm.Plugin) Option {
 	}
 }
 
+// WithMaxIdleConn provide max idle connections of database, must be called after WithDatabase
+func WithMaxIdleConn(name string, maxIdleConn int) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.poolInnerDb(name, "WithMaxIdleConn"); inner != nil {
+			inner.maxIdleConn = maxIdleConn
+		}
+	}
+}
+
+// WithMaxOpenConn provide max open connections of database, must be called after WithDatabase
+func WithMaxOpenConn(name string, maxOpenConn int) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.poolInnerDb(name, "WithMaxOpenConn"); inner != nil {
+			inner.maxOpenConn = maxOpenConn
+		}
+	}
+}
+
+// WithConnMaxLifetime provide max lifetime of connections of database, must be called after WithDatabase
+func WithConnMaxLifetime(name string, lifetime time.Duration) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.poolInnerDb(name, "WithConnMaxLifetime"); inner != nil {
+			inner.connMaxLifetime = lifetime
+		}
+	}
+}
+
+// WithConnMaxIdleTime provide max idle time of connections of database, must be called after WithDatabase
+func WithConnMaxIdleTime(name string, idleTime time.Duration) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.poolInnerDb(name, "WithConnMaxIdleTime"); inner != nil {
+			inner.connMaxIdleTime = idleTime
+		}
+	}
+}
+
+// WithReplicas provide read replicas of database, SELECT will be routed to replicas with policy of random or roundrobin.
+// Must be called after WithDatabase.
+func WithReplicas(name, policy string, addrs ...string) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.getInnerDb(name); inner != nil && len(addrs) > 0 {
+			inner.replicaAddrs = append(inner.replicaAddrs, addrs...)
+			inner.replicaPolicy = policy
+		}
+	}
+}
+
+// WithGormOptions provide GormConfig of database which will be mapped onto gorm.Config, must be called after WithDatabase
+func WithGormOptions(name string, options GormConfig) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.getInnerDb(name); inner != nil {
+			inner.gormOptions = options
+		}
+	}
+}
+
+// WithGormConfig provide gorm.Config of database which overrides the generated one, must be called after WithDatabase.
+// Logger of entry will be assigned if Logger of config is nil, and DryRun will be enabled if database is in dry run mode.
+//
+// It must be supplied at registration time, modifying GormConfigMap after RegisterMySqlEntry is not supported
+// since Bootstrap may have been called by rk-boot already.
+func WithGormConfig(name string, config *gorm.Config) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.getInnerDb(name); inner != nil && config != nil {
+			inner.gormConfig = config
+		}
+	}
+}
+
+// WithTimeouts provide default dial, read and write timeouts of databases
+func WithTimeouts(dial, read, write time.Duration) Option {
+	return func(entry *MySqlEntry) {
+		entry.timeouts = timeouts{dial: dial, read: read, write: write}
+	}
+}
+
+// WithDatabaseTimeouts provide dial, read and write timeouts of database which override the ones of entry,
+// must be called after WithDatabase
+func WithDatabaseTimeouts(name string, dial, read, write time.Duration) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.getInnerDb(name); inner != nil {
+			inner.timeouts = timeouts{dial: dial, read: read, write: write}
+		}
+	}
+}
+
+// WithStatementParams provide interpolateParams and multiStatements params of database, must be called after WithDatabase.
+//
+// multiStatements broadens blast radius of SQL injection, a warning will be logged if enabled,
+// and it could not be used with prepareStmt of gorm.
+func WithStatementParams(name string, interpolateParams, multiStatements bool) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.getInnerDb(name); inner != nil {
+			inner.statements = statementParams{
+				interpolateParams: interpolateParams,
+				multiStatements:   multiStatements,
+			}
+		}
+	}
+}
+
+// WithDsn provide complete DSN of database which is passed to driver verbatim, must be called after WithDatabase.
+// Addr, user, pass, protocol and params are ignored for the database. Database is created with adminDsn if autoCreate enabled.
+func WithDsn(name, dsn, adminDsn string) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.getInnerDb(name); inner != nil {
+			inner.dsn = dsn
+			inner.adminDsn = adminDsn
+		}
+	}
+}
+
+// WithCompatParams provide allowNativePasswords, allowCleartextPasswords and compress params of database,
+// must be called after WithDatabase. A warning will be logged if cleartext passwords allowed.
+func WithCompatParams(name string, params CompatParams) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.getInnerDb(name); inner != nil {
+			inner.compat = params
+		}
+	}
+}
+
+// WithTimeZone provide time zone of database which is converted into loc param of DSN, like UTC or Asia/Shanghai.
+// If storeUTC is true, NowFunc of gorm.Config returns UTC time, so created_at and updated_at are always UTC.
+// Must be called after WithDatabase.
+func WithTimeZone(name, timeZone string, storeUTC bool) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.getInnerDb(name); inner != nil {
+			inner.timeZone = timeZone
+			inner.storeUTC = storeUTC
+		}
+	}
+}
+
+// WithMigrations provide directory of .sql migrations of database, table defaults to schema_migrations,
+// should be called after WithDatabase()
+func WithMigrations(name, dir, table string) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.getInnerDb(name); inner != nil && len(dir) > 0 {
+			if len(table) < 1 {
+				table = "schema_migrations"
+			}
+			inner.migrations = &migrations{
+				dir:   toAbsPath(dir)[0],
+				table: table,
+			}
+		}
+	}
+}
+
+// WithSeed provide seed script and statements of database which are executed only if database created by autoCreate.
+// Bootstrap will be aborted if seeding failed and fatal is true, otherwise a warning will be logged.
+// Should be called after WithDatabase()
+func WithSeed(name, script string, sql []string, fatal bool) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.getInnerDb(name); inner != nil && (len(script) > 0 || len(sql) > 0) {
+			inner.seed = &seedOptions{
+				sql:   sql,
+				fatal: fatal,
+			}
+			if len(script) > 0 {
+				inner.seed.script = toAbsPath(script)[0]
+			}
+		}
+	}
+}
+
+// WithDatabaseLogger provide logger settings of database which override the ones of entry,
+// should be called after WithDatabase()
+func WithDatabaseLogger(name string, override DatabaseLogger) Option {
+	return func(entry *MySqlEntry) {
+		if inner := entry.getInnerDb(name); inner != nil {
+			inner.loggerOverride = override
+		}
+	}
+}
+
+// WithLazy skips connecting in Bootstrap, databases will be connected by first GetDB, GetDBE or Connect
+func WithLazy() Option {
+	return func(entry *MySqlEntry) {
+		entry.lazy = true
+	}
+}
+
+// WithMinServerVersion provide minimum version of server, like 8.0 or 8.0.13, which will be checked after connected.
+// Connecting fails if server is older and fatal is true, otherwise a warning will be logged.
+func WithMinServerVersion(version string, fatal bool) Option {
+	return func(entry *MySqlEntry) {
+		entry.minServerVersion = version
+		entry.minServerVersionErr = fatal
+	}
+}
+
+// WithReconnectGrace provide duration old connections kept open after Reconnect, default is 30 seconds
+func WithReconnectGrace(grace time.Duration) Option {
+	return func(entry *MySqlEntry) {
+		if grace > 0 {
+			entry.reconnectGrace = grace
+		}
+	}
+}
+
+// WithHealthCheck enables background health check which pings databases periodically
+func WithHealthCheck(interval, timeout time.Duration) Option {
+	return func(entry *MySqlEntry) {
+		entry.healthCheckEnabled = true
+		if interval > 0 {
+			entry.healthCheckInterval = interval
+		}
+		if timeout > 0 {
+			entry.healthCheckTimeout = timeout
+		}
+	}
+}
+
+// WithPingTimeout provide timeout of each ping of IsHealthy and HealthStatus, health check is not enabled by it
+func WithPingTimeout(timeout time.Duration) Option {
+	return func(entry *MySqlEntry) {
+		if timeout > 0 {
+			entry.healthCheckTimeout = timeout
+		}
+	}
+}
+
+// WithRetry retries connecting to database on transient errors like connection refused.
+// Interval will be doubled after every attempt until reaching maxInterval if maxInterval is larger than interval.
+func WithRetry(maxAttempts int, interval, maxInterval time.Duration) Option {
+	return func(entry *MySqlEntry) {
+		entry.retryMaxAttempts = maxAttempts
+		if interval > 0 {
+			entry.retryInterval = interval
+		}
+		entry.retryMaxInterval = maxInterval
+	}
+}
+
+// WithCertEntry provide CertEntry, connections will be encrypted with TLS
+func WithCertEntry(certEntry *rkentry.CertEntry) Option {
+	return func(entry *MySqlEntry) {
+		if certEntry != nil {
+			entry.certEntry = certEntry
+			entry.tlsEnabled = true
+		}
+	}
+}
+
+// WithTlsMode provide TLS mode, one of required, verify-ca and skip-verify,
+// connections will be encrypted with TLS even if CertEntry is not provided
+func WithTlsMode(mode string) Option {
+	return func(entry *MySqlEntry) {
+		if len(mode) > 0 {
+			entry.tlsMode = mode
+			entry.tlsEnabled = true
+		}
+	}
+}
+
 // WithLogger provide Logger
 func WithLogger(logger *Logger) Option {
 	return func(m *MySqlEntry) {
@@ -193,6 +692,62 @@ func WithLogger(logger *Logger) Option {
 	}
 }
 
+// DatabaseOption for database added by AddDatabase
+type DatabaseOption func(*databaseInner)
+
+// WithDbAutoCreate create database if missing
+func WithDbAutoCreate() DatabaseOption {
+	return func(innerDb *databaseInner) {
+		innerDb.autoCreate = true
+	}
+}
+
+// WithDbParams provide connection params, default params will be omitted
+func WithDbParams(params ...string) DatabaseOption {
+	return func(innerDb *databaseInner) {
+		innerDb.params = append(make([]string, 0), params...)
+	}
+}
+
+// WithDbPool provide max idle and max open connections of pool
+func WithDbPool(maxIdleConn, maxOpenConn int) DatabaseOption {
+	return func(innerDb *databaseInner) {
+		innerDb.maxIdleConn = maxIdleConn
+		innerDb.maxOpenConn = maxOpenConn
+	}
+}
+
+// WithDbPlugin provide gorm.Plugin, like prom plugin
+func WithDbPlugin(plugin gorm.Plugin) DatabaseOption {
+	return func(innerDb *databaseInner) {
+		if plugin != nil {
+			innerDb.plugins = append(innerDb.plugins, plugin)
+		}
+	}
+}
+
+// WithDbGormConfig provide GormConfig
+func WithDbGormConfig(config GormConfig) DatabaseOption {
+	return func(innerDb *databaseInner) {
+		innerDb.gormOptions = config
+	}
+}
+
+// WithDbTimeZone provide time zone of database, see WithTimeZone for details
+func WithDbTimeZone(timeZone string, storeUTC bool) DatabaseOption {
+	return func(innerDb *databaseInner) {
+		innerDb.timeZone = timeZone
+		innerDb.storeUTC = storeUTC
+	}
+}
+
+// WithDbDialector provide gorm.Dialector, autoCreate, replicas and DSN construction will be skipped
+func WithDbDialector(dialector gorm.Dialector) DatabaseOption {
+	return func(innerDb *databaseInner) {
+		innerDb.dialector = dialector
+	}
+}
+
 // RegisterMySqlEntryYAML register MySqlEntry based on config file into rkentry.GlobalAppCtx
 func RegisterMySqlEntryYAML(raw []byte) map[string]rkentry.Entry {
 	res := make(map[string]rkentry.Entry)
@@ -229,6 +784,22 @@ func RegisterMySqlEntryYAML(raw []byte) map[string]rkentry.Entry {
 	}
 
 	for _, element := range configMap {
+		// precedence of password: pass < passFile < ${ENV} reference in pass
+		passFromEnv := strings.Contains(element.Pass, "${")
+
+		// expand environment variables in credentials
+		fields := []*string{&element.User, &element.Pass}
+		for i := range element.Database {
+			fields = append(fields, &element.Database[i].Dsn, &element.Database[i].AdminDsn)
+		}
+		for _, field := range fields {
+			expanded, err := expandEnv(*field)
+			if err != nil {
+				rkentry.ShutdownWithError(fmt.Errorf("failed to expand config of MySqlEntry %s, %v", element.Name, err))
+			}
+			*field = expanded
+		}
+
 		logger := &Logger{
 			LogLevel:                  gormLogger.Warn,
 			SlowThreshold:             5000 * time.Millisecond,
@@ -236,16 +807,7 @@ func RegisterMySqlEntryYAML(raw []byte) map[string]rkentry.Entry {
 		}
 
 		// configure log level
-		switch element.Logger.Level {
-		case "info":
-			logger.LogLevel = gormLogger.Info
-		case "warn":
-			logger.LogLevel = gormLogger.Warn
-		case "error":
-			logger.LogLevel = gormLogger.Error
-		case "silent":
-			logger.LogLevel = gormLogger.Silent
-		}
+		logger.LogLevel = toGormLogLevel(element.Logger.Level, logger.LogLevel)
 
 		// configure slow threshold
 		if element.Logger.SlowThresholdMs > 0 {
@@ -289,22 +851,99 @@ func RegisterMySqlEntryYAML(raw []byte) map[string]rkentry.Entry {
 			WithPass(element.Pass),
 			WithProtocol(element.Protocol),
 			WithAddr(element.Addr),
+			WithAddrs(element.Addrs...),
 			WithLogger(logger),
+			WithTlsMode(element.TlsMode),
+			WithPingTimeout(time.Duration(element.HealthCheck.TimeoutMs) * time.Millisecond),
+			WithTimeouts(
+				time.Duration(element.DialTimeoutMs)*time.Millisecond,
+				time.Duration(element.ReadTimeoutMs)*time.Millisecond,
+				time.Duration(element.WriteTimeoutMs)*time.Millisecond),
+			WithRetry(element.Retry.MaxAttempts,
+				time.Duration(element.Retry.IntervalMs)*time.Millisecond,
+				time.Duration(element.Retry.MaxIntervalMs)*time.Millisecond),
+		}
+
+		if len(element.CertEntry) > 0 {
+			certEntry := rkentry.GlobalAppCtx.GetCertEntry(element.CertEntry)
+			if certEntry == nil {
+				rkentry.ShutdownWithError(fmt.Errorf("certEntry %s of MySqlEntry %s not found",
+					element.CertEntry, element.Name))
+			}
+			opts = append(opts, WithCertEntry(certEntry))
+		}
+
+		if len(element.PassFile) > 0 && !passFromEnv {
+			opts = append(opts, WithPassFile(element.PassFile))
+		}
+
+		if element.Lazy {
+			opts = append(opts, WithLazy())
+		}
+
+		if len(element.MinServerVersion) > 0 {
+			opts = append(opts, WithMinServerVersion(element.MinServerVersion,
+				strings.ToLower(element.MinServerVersionOnError) != "warn"))
+		}
+
+		if element.ReconnectGraceMs > 0 {
+			opts = append(opts, WithReconnectGrace(time.Duration(element.ReconnectGraceMs)*time.Millisecond))
+		}
+
+		if element.HealthCheck.Enabled {
+			opts = append(opts, WithHealthCheck(
+				time.Duration(element.HealthCheck.IntervalMs)*time.Millisecond,
+				time.Duration(element.HealthCheck.TimeoutMs)*time.Millisecond))
 		}
 
 		// iterate database section
 		for _, db := range element.Database {
-			opts = append(opts, WithDatabase(db.Name, db.DryRun, db.AutoCreate, db.Params...))
+			opts = append(opts,
+				WithDatabase(db.Name, db.DryRun, db.AutoCreate, db.Params...),
+				WithMaxIdleConn(db.Name, db.MaxIdleConn),
+				WithMaxOpenConn(db.Name, db.MaxOpenConn),
+				WithConnMaxLifetime(db.Name, time.Duration(db.ConnMaxLifetimeMs)*time.Millisecond),
+				WithConnMaxIdleTime(db.Name, time.Duration(db.ConnMaxIdleTimeMs)*time.Millisecond),
+				WithReplicas(db.Name, db.Replicas.Policy, db.Replicas.Addrs...),
+				WithGormOptions(db.Name, db.Gorm),
+				WithDatabaseTimeouts(db.Name,
+					time.Duration(db.DialTimeoutMs)*time.Millisecond,
+					time.Duration(db.ReadTimeoutMs)*time.Millisecond,
+					time.Duration(db.WriteTimeoutMs)*time.Millisecond),
+				WithStatementParams(db.Name, db.InterpolateParams, db.MultiStatements),
+				WithTimeZone(db.Name, db.TimeZone, db.StoreUTC),
+				WithCompatParams(db.Name, CompatParams{
+					AllowNativePasswords:    db.AllowNativePasswords,
+					AllowCleartextPasswords: db.AllowCleartextPasswords,
+					Compress:                db.Compress,
+				}),
+				WithDsn(db.Name, db.Dsn, db.AdminDsn),
+				WithMigrations(db.Name, db.Migrations.Dir, db.Migrations.Table),
+				WithSeed(db.Name, db.SeedScript, db.SeedSQL, strings.ToLower(db.SeedOnError) != "warn"),
+				WithDatabaseLogger(db.Name, DatabaseLogger{
+					Level:                     db.Logger.Level,
+					SlowThreshold:             time.Duration(db.Logger.SlowThresholdMs) * time.Millisecond,
+					IgnoreRecordNotFoundError: db.Logger.IgnoreRecordNotFoundError,
+				}))
 
 			if db.Plugins.Prom.Enabled {
 				db.Plugins.Prom.DbAddr = element.Addr
 				db.Plugins.Prom.DbName = db.Name
 				db.Plugins.Prom.DbType = "mysql"
+				if err := db.Plugins.Prom.Table.Validate(); err != nil {
+					rkentry.ShutdownWithError(fmt.Errorf("invalid table rewrite of prom plugin of database %s, %v", db.Name, err))
+				}
 				prom := plugins.NewProm(&db.Plugins.Prom)
 				opts = append(opts, WithPlugin(db.Name, prom))
 			}
 		}
 
+		// skip broken entry instead of failing at bootstrap
+		if err := newMySqlEntry(opts...).Validate(); err != nil {
+			logger.delegate.Error("Skip invalid MySqlEntry", zap.String("entryName", element.Name), zap.Error(err))
+			continue
+		}
+
 		entry := RegisterMySqlEntry(opts...)
 
 		res[element.Name] = entry
@@ -315,28 +954,33 @@ func RegisterMySqlEntryYAML(raw []byte) map[string]rkentry.Entry {
 
 // RegisterMySqlEntry will register Entry into GlobalAppCtx
 func RegisterMySqlEntry(opts ...Option) *MySqlEntry {
-	entry := &MySqlEntry{
-		entryName:        "MySql",
-		entryType:        MySqlEntryType,
-		entryDescription: "MySql entry for gorm.DB",
-		User:             "root",
-		pass:             "pass",
-		Protocol:         "tcp",
-		Addr:             "localhost:3306",
-		innerDbList:      make([]*databaseInner, 0),
-		GormDbMap:        make(map[string]*gorm.DB),
-		GormConfigMap:    make(map[string]*gorm.Config),
+	entry := newMySqlEntry(opts...)
+
+	if err := entry.Validate(); err != nil {
+		rkentry.ShutdownWithError(err)
 	}
 
-	entry.logger = &Logger{
-		delegate:                  rkentry.GlobalAppCtx.GetLoggerEntryDefault().Logger,
-		SlowThreshold:             5000 * time.Millisecond,
-		LogLevel:                  gormLogger.Warn,
-		IgnoreRecordNotFoundError: false,
+	if len(entry.passFile) > 0 {
+		pass, err := readPassFile(entry.passFile)
+		if err != nil {
+			rkentry.ShutdownWithError(fmt.Errorf("failed to read passFile of MySqlEntry %s, %v", entry.entryName, err))
+		}
+		entry.pass = pass
 	}
 
-	for i := range opts {
-		opts[i](entry)
+	// connection fields configured explicitly, which are ignored by databases with raw DSN
+	connFields := entry.explicitConnFields()
+
+	entry.defaultAddr()
+
+	if len(entry.Addrs) > 1 {
+		entry.nodeChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   "rk",
+			Subsystem:   "mysql",
+			Name:        "activeNodeChanges",
+			Help:        "Changes of active node of MySqlEntry",
+			ConstLabels: prometheus.Labels{"entryName": entry.entryName},
+		}, []string{"from", "to"})
 	}
 
 	if len(entry.entryDescription) < 1 {
@@ -349,49 +993,167 @@ func RegisterMySqlEntry(opts ...Option) *MySqlEntry {
 
 	// create default gorm configs for databases
 	for _, innerDb := range entry.innerDbList {
-		entry.GormConfigMap[innerDb.name] = &gorm.Config{
-			Logger: entry.logger,
-			DryRun: innerDb.dryRun,
+		innerDb.logger = entry.toDatabaseLogger(innerDb)
+		entry.GormConfigMap[innerDb.name] = entry.toGormConfig(innerDb)
+
+		if len(innerDb.dsn) > 0 {
+			if err := entry.validateDsn(innerDb, connFields); err != nil {
+				rkentry.ShutdownWithError(err)
+			}
+			continue
 		}
-	}
 
-	rkentry.GlobalAppCtx.AddEntry(entry)
+		if err := entry.applyTimeouts(innerDb); err != nil {
+			rkentry.ShutdownWithError(err)
+		}
 
-	return entry
-}
+		if err := entry.applyStatementParams(innerDb, entry.GormConfigMap[innerDb.name]); err != nil {
+			rkentry.ShutdownWithError(err)
+		}
 
-// Bootstrap MySqlEntry
-func (entry *MySqlEntry) Bootstrap(ctx context.Context) {
-	// extract eventId if exists
-	fields := make([]zap.Field, 0)
+		if err := entry.applyCompatParams(innerDb); err != nil {
+			rkentry.ShutdownWithError(err)
+		}
 
-	if val := ctx.Value("eventId"); val != nil {
-		if id, ok := val.(string); ok {
-			fields = append(fields, zap.String("eventId", id))
+		if err := entry.applyTimeZone(innerDb); err != nil {
+			rkentry.ShutdownWithError(err)
 		}
 	}
 
-	fields = append(fields,
-		zap.String("entryName", entry.entryName),
-		zap.String("entryType", entry.entryType))
-
-	entry.logger.delegate.Info("Bootstrap MySqlEntry", fields...)
+	rkentry.GlobalAppCtx.AddEntry(entry)
 
-	// Connect and create db if missing
-	if err := entry.connect(); err != nil {
-		fields = append(fields, zap.Error(err))
-		entry.logger.delegate.Error("Failed to connect to database", fields...)
-		rkentry.ShutdownWithError(fmt.Errorf("failed to connect to database at %s:%s@%s(%s)",
-			entry.User, "****", entry.Protocol, entry.Addr))
-	}
+	return entry
 }
 
-// Interrupt MySqlEntry
-func (entry *MySqlEntry) Interrupt(ctx context.Context) {
-	for _, db := range entry.GormDbMap {
-		closeDB(db)
+// Create MySqlEntry with defaults and apply options, without validation
+func newMySqlEntry(opts ...Option) *MySqlEntry {
+	entry := &MySqlEntry{
+		entryName:        "MySql",
+		entryType:        MySqlEntryType,
+		entryDescription: "MySql entry for gorm.DB",
+		User:             "root",
+		pass:             "pass",
+		Protocol:         ProtocolTcp,
+		innerDbList:      make([]*databaseInner, 0),
+		GormDbMap:        make(map[string]*gorm.DB),
+		GormConfigMap:    make(map[string]*gorm.Config),
+		replicaDbMap:     make(map[string][]*replicaDb),
+		quitChannel:      make(chan struct{}),
+		// used by IsHealthy even if health check is disabled
+		healthCheckInterval: 5000 * time.Millisecond,
+		healthCheckTimeout:  2000 * time.Millisecond,
+		tlsMode:             TlsModeRequired,
+		// fail fast by default
+		retryInterval:  1000 * time.Millisecond,
+		reconnectGrace: 30 * time.Second,
+	}
+
+	entry.logger = &Logger{
+		delegate:                  rkentry.GlobalAppCtx.GetLoggerEntryDefault().Logger,
+		SlowThreshold:             5000 * time.Millisecond,
+		LogLevel:                  gormLogger.Warn,
+		IgnoreRecordNotFoundError: false,
+	}
+
+	for i := range opts {
+		opts[i](entry)
+	}
+
+	return entry
+}
+
+// Bootstrap MySqlEntry
+func (entry *MySqlEntry) Bootstrap(ctx context.Context) {
+	// extract eventId if exists
+	fields := make([]zap.Field, 0)
+
+	if val := ctx.Value("eventId"); val != nil {
+		if id, ok := val.(string); ok {
+			fields = append(fields, zap.String("eventId", id))
+		}
+	}
+
+	fields = append(fields,
+		zap.String("entryName", entry.entryName),
+		zap.String("entryType", entry.entryType))
+
+	entry.logger.delegate.Info("Bootstrap MySqlEntry", fields...)
+
+	// register TLS config into driver which will be referenced by DSN
+	if entry.tlsEnabled {
+		tlsConfig, err := entry.toTlsConfig()
+		if err != nil {
+			fields = append(fields, zap.Error(err))
+			entry.logger.delegate.Error("Failed to build TLS config", fields...)
+			rkentry.ShutdownWithError(err)
+		}
+
+		entry.tlsConfigName = fmt.Sprintf("rk-%s", entry.entryName)
+		if err := driver.RegisterTLSConfig(entry.tlsConfigName, tlsConfig); err != nil {
+			rkentry.ShutdownWithError(err)
+		}
 	}
 
+	// connect while first GetDB, GetDBE or Connect called
+	if entry.lazy {
+		entry.logger.delegate.Info("Lazy mode enabled, skip connecting to database", fields...)
+	} else if err := entry.Connect(ctx); err != nil {
+		fields = append(fields, zap.Error(err))
+		entry.logger.delegate.Error("Failed to connect to database", fields...)
+		rkentry.ShutdownWithError(fmt.Errorf("failed to connect to database at %s:%s@%s(%s), %v",
+			entry.User, "****", entry.Protocol, entry.activeAddr(), err))
+	}
+
+	// enable health check
+	if entry.healthCheckEnabled {
+		go entry.runHealthCheck()
+	}
+}
+
+// Ping databases periodically until entry interrupted
+func (entry *MySqlEntry) runHealthCheck() {
+	ticker := time.NewTicker(entry.healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-entry.quitChannel:
+			return
+		case <-ticker.C:
+			if !entry.IsHealthy() {
+				entry.logger.delegate.Warn("MySqlEntry is unhealthy",
+					zap.String("entryName", entry.entryName),
+					zap.String("addr", entry.activeAddr()))
+			}
+
+			if len(entry.Addrs) > 1 && entry.isConnected() {
+				entry.checkNodes()
+			}
+		}
+	}
+}
+
+// Interrupt MySqlEntry
+func (entry *MySqlEntry) Interrupt(ctx context.Context) {
+	entry.interruptOnce.Do(func() {
+		// stop health checker first
+		close(entry.quitChannel)
+
+		if len(entry.tlsConfigName) > 0 {
+			driver.DeregisterTLSConfig(entry.tlsConfigName)
+		}
+
+		entry.lock.Lock()
+		for _, db := range entry.GormDbMap {
+			closeDB(db)
+		}
+
+		for _, replicas := range entry.replicaDbMap {
+			closeReplicas(replicas)
+		}
+		entry.lock.Unlock()
+	})
+
 	// extract eventId if exists
 	fields := make([]zap.Field, 0)
 
@@ -420,11 +1182,28 @@ func (entry *MySqlEntry) GetType() string {
 
 // GetDescription returns entry description
 func (entry *MySqlEntry) GetDescription() string {
+	if version := entry.GetServerVersion(); len(version) > 0 {
+		return fmt.Sprintf("%s, serverVersion:%s", entry.entryDescription, version)
+	}
+
 	return entry.entryDescription
 }
 
+// GetServerVersion returns result of SELECT VERSION(), empty string will be returned if not connected
+func (entry *MySqlEntry) GetServerVersion() string {
+	entry.lock.RLock()
+	defer entry.lock.RUnlock()
+
+	return entry.ServerVersion
+}
+
 // String returns json marshalled string
 func (entry *MySqlEntry) String() string {
+	entry.lock.RLock()
+	defer entry.lock.RUnlock()
+	entry.credLock.RLock()
+	defer entry.credLock.RUnlock()
+
 	bytes, err := json.Marshal(entry)
 	if err != nil || len(bytes) < 1 {
 		return "{}"
@@ -433,24 +1212,109 @@ func (entry *MySqlEntry) String() string {
 	return string(bytes)
 }
 
-// IsHealthy checks healthy status remote provider
+// IsHealthy returns true if connected and all databases and replicas respond to ping within timeout
 func (entry *MySqlEntry) IsHealthy() bool {
-	for _, gormDb := range entry.GormDbMap {
-		if db, err := gormDb.DB(); err != nil {
-			return false
-		} else {
-			if err := db.Ping(); err != nil {
-				return false
-			}
+	if !entry.isConnected() {
+		return false
+	}
+
+	healthy := true
+	for key, status := range entry.HealthStatus() {
+		if !status.Healthy {
+			entry.logger.delegate.Warn("failed to ping DB",
+				zap.String("db", key),
+				zap.Duration("latency", status.Latency),
+				zap.Error(status.Err))
+			healthy = false
 		}
 	}
 
-	return true
+	return healthy
+}
+
+// HealthStatus is result of pinging a database or replica
+type HealthStatus struct {
+	Healthy   bool
+	Err       error
+	Latency   time.Duration
+	CheckedAt time.Time
+}
+
+// HealthStatus pings every database and replica concurrently with timeout, so it returns within one ping timeout.
+//
+// Databases are keyed with name, replicas are keyed with database name and address, like user/replica-1:3306.
+// Databases not connected yet in lazy mode will be reported with ErrNotConnected. It is safe to call concurrently.
+func (entry *MySqlEntry) HealthStatus() map[string]*HealthStatus {
+	res := make(map[string]*HealthStatus)
+	targets := make(map[string]*sql.DB)
+
+	// collect targets, then ping without lock, so connecting and AddDatabase won't be blocked by slow pings
+	entry.lock.RLock()
+	for _, innerDb := range entry.innerDbList {
+		if _, ok := entry.GormDbMap[innerDb.name]; !ok {
+			res[innerDb.name] = &HealthStatus{Err: ErrNotConnected, CheckedAt: time.Now()}
+		}
+	}
+
+	for name, gormDb := range entry.GormDbMap {
+		db, err := gormDb.DB()
+		if err != nil {
+			res[name] = &HealthStatus{Err: entry.redactError(err), CheckedAt: time.Now()}
+			continue
+		}
+
+		targets[name] = db
+	}
+
+	for name, replicas := range entry.replicaDbMap {
+		for _, replica := range replicas {
+			targets[fmt.Sprintf("%s/%s", name, replica.addr)] = replica.db
+		}
+	}
+	entry.lock.RUnlock()
+
+	wg := sync.WaitGroup{}
+	lock := sync.Mutex{}
+	for key, db := range targets {
+		wg.Add(1)
+		go func(key string, db *sql.DB) {
+			defer wg.Done()
+			status := entry.ping(db)
+
+			lock.Lock()
+			res[key] = status
+			lock.Unlock()
+		}(key, db)
+	}
+	wg.Wait()
+
+	return res
+}
+
+// Ping with health check timeout
+func (entry *MySqlEntry) ping(db *sql.DB) *HealthStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), entry.healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := db.PingContext(ctx)
+
+	return &HealthStatus{
+		Healthy:   err == nil,
+		Err:       entry.redactError(err),
+		Latency:   time.Since(start),
+		CheckedAt: start,
+	}
 }
 
 func (entry *MySqlEntry) RegisterPromMetrics(registry *prometheus.Registry) error {
-	for i := range entry.innerDbList {
-		innerDb := entry.innerDbList[i]
+	if entry.nodeChanges != nil {
+		if err := registry.Register(entry.nodeChanges); err != nil {
+			return err
+		}
+	}
+
+	for _, innerDb := range entry.databases() {
 		for j := range innerDb.plugins {
 			p := innerDb.plugins[j]
 			if v, ok := p.(*plugins.Prom); ok {
@@ -484,98 +1348,1680 @@ func (entry *MySqlEntry) RegisterPromMetrics(registry *prometheus.Registry) erro
 	return nil
 }
 
+// GetDB returns gorm.DB with database name, a warning with available database names will be logged if missing.
+// Databases will be connected in lazy mode if not connected yet, use GetDBE to get error of connecting.
 func (entry *MySqlEntry) GetDB(name string) *gorm.DB {
-	return entry.GormDbMap[name]
+	db, err := entry.GetDBE(name)
+	if err == nil {
+		return db
+	}
+
+	if entry.getInnerDb(name) != nil {
+		entry.logger.delegate.Warn(fmt.Sprintf("Failed to get database [%s]", name), zap.Error(err))
+		return nil
+	}
+
+	names := make([]string, 0)
+	for _, innerDb := range entry.databases() {
+		names = append(names, innerDb.name)
+	}
+
+	entry.logger.delegate.Warn(fmt.Sprintf("Database [%s] not found in MySqlEntry [%s]", name, entry.entryName),
+		zap.Strings("available", names))
+
+	return nil
+}
+
+// GetDBE returns gorm.DB with database name, databases will be connected in lazy mode if not connected yet,
+// and error of connecting will be returned if failed.
+func (entry *MySqlEntry) GetDBE(name string) (*gorm.DB, error) {
+	// unknown database won't be connected
+	if entry.getInnerDb(name) == nil {
+		return nil, fmt.Errorf("database %s not found in MySqlEntry %s", name, entry.entryName)
+	}
+
+	// skip connectLock once connected, so that callers won't wait for each other
+	if entry.lazy && !entry.isConnected() {
+		ctx, cancel := context.WithTimeout(context.Background(), LazyConnectTimeout)
+		err := entry.Connect(ctx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entry.lock.RLock()
+	db, ok := entry.GormDbMap[name]
+	entry.lock.RUnlock()
+
+	if ok {
+		return db, nil
+	}
+
+	return nil, ErrNotConnected
+}
+
+// Connect to databases and create them if missing, nothing will be done if connected already.
+// Concurrent callers wait for the same attempt, and failed attempt will be retried by next call.
+// ErrInterrupted will be returned once entry interrupted, so that no connections will be leaked.
+func (entry *MySqlEntry) Connect(ctx context.Context) error {
+	entry.connectLock.Lock()
+	defer entry.connectLock.Unlock()
+
+	if entry.isConnected() {
+		return nil
+	}
+
+	if entry.isInterrupted() {
+		return ErrInterrupted
+	}
+
+	entry.connectErr = entry.connect(ctx)
+	if entry.connectErr == nil {
+		entry.lock.Lock()
+		entry.connected = true
+		entry.lock.Unlock()
+	}
+
+	return entry.connectErr
+}
+
+// Returns true once Interrupt called
+func (entry *MySqlEntry) isInterrupted() bool {
+	select {
+	case <-entry.quitChannel:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns true if all databases connected
+func (entry *MySqlEntry) isConnected() bool {
+	entry.lock.RLock()
+	defer entry.lock.RUnlock()
+
+	return entry.connected
 }
 
-// Create database if missing
-func (entry *MySqlEntry) connect() error {
+// NamedDB is a gorm.DB with its database name
+type NamedDB struct {
+	Name string
+	DB   *gorm.DB
+}
+
+// GetDBList returns connected gorm.DB list in the same order as database in boot config
+func (entry *MySqlEntry) GetDBList() []NamedDB {
+	entry.lock.RLock()
+	defer entry.lock.RUnlock()
+
+	res := make([]NamedDB, 0, len(entry.innerDbList))
 	for _, innerDb := range entry.innerDbList {
-		var db *gorm.DB
-		var err error
+		if db, ok := entry.GormDbMap[innerDb.name]; ok {
+			res = append(res, NamedDB{Name: innerDb.name, DB: db})
+		}
+	}
 
-		sqlParams := strings.Join(innerDb.params, "&")
+	return res
+}
 
-		// 1: create db if missing
-		if !innerDb.dryRun && innerDb.autoCreate {
-			entry.logger.delegate.Info(fmt.Sprintf("Creating database [%s]", innerDb.name))
+// GetDefaultDB returns the only gorm.DB if exactly one database configured, nil will be returned otherwise
+func (entry *MySqlEntry) GetDefaultDB() *gorm.DB {
+	innerDbList := entry.databases()
+	if len(innerDbList) != 1 {
+		return nil
+	}
 
-			dsn := fmt.Sprintf("%s:%s@%s(%s)/?%s",
-				entry.User, entry.pass, entry.Protocol, entry.Addr, sqlParams)
+	return entry.GetDB(innerDbList[0].name)
+}
 
-			db, err = gorm.Open(mysql.Open(dsn), entry.GormConfigMap[innerDb.name])
+// AddDatabase connects to database with name at runtime, and creates it if WithDbAutoCreate provided.
+//
+// Database uses logger and timeouts of entry, and default params unless WithDbParams provided.
+// It is safe to call GetDB concurrently, database will be visible once connected.
+func (entry *MySqlEntry) AddDatabase(ctx context.Context, name string, opts ...DatabaseOption) (err error) {
+	// driver errors may embed DSN, never expose password
+	defer func() {
+		err = entry.redactError(err)
+	}()
+
+	if len(name) < 1 {
+		return errors.New("empty database name")
+	}
 
-			// failed to connect to database
-			if err != nil {
-				closeDB(db)
-				return err
-			}
+	if entry.getInnerDb(name) != nil {
+		return fmt.Errorf("database %s already exists in MySqlEntry %s", name, entry.entryName)
+	}
 
-			createSQL := fmt.Sprintf(
-				"CREATE DATABASE IF NOT EXISTS `%s` CHARACTER SET utf8mb4;",
-				innerDb.name,
-			)
+	innerDb := &databaseInner{
+		name:   name,
+		params: []string{"charset=utf8mb4", "parseTime=True", "loc=Local"},
+	}
 
-			db = db.Exec(createSQL)
+	for i := range opts {
+		opts[i](innerDb)
+	}
 
-			if db.Error != nil {
-				closeDB(db)
-				return db.Error
-			}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := entry.applyTimeouts(innerDb); err != nil {
+		return err
+	}
+
+	innerDb.logger = entry.toDatabaseLogger(innerDb)
+	config := entry.toGormConfig(innerDb)
+
+	if err := entry.applyStatementParams(innerDb, config); err != nil {
+		return err
+	}
+
+	if err := entry.applyCompatParams(innerDb); err != nil {
+		return err
+	}
 
+	if err := entry.applyTimeZone(innerDb); err != nil {
+		return err
+	}
+
+	db, replicas, err := entry.connectDatabase(ctx, innerDb, config)
+	if err != nil {
+		return err
+	}
+
+	entry.lock.Lock()
+	// added by others while connecting
+	for _, v := range entry.innerDbList {
+		if v.name == name {
+			entry.lock.Unlock()
+			closeReplicas(replicas)
 			closeDB(db)
-			entry.logger.delegate.Info(fmt.Sprintf("Creating database [%s] successs", innerDb.name))
+			return fmt.Errorf("database %s already exists in MySqlEntry %s", name, entry.entryName)
+		}
+	}
+	entry.innerDbList = append(entry.innerDbList, innerDb)
+	entry.GormConfigMap[name] = config
+	entry.GormDbMap[name] = db
+	if len(replicas) > 0 {
+		entry.replicaDbMap[name] = replicas
+	}
+	entry.lock.Unlock()
+
+	entry.logger.delegate.Info(fmt.Sprintf("Adding database [%s] success", name))
+
+	return nil
+}
+
+// RemoveDatabase closes connections of database with name and removes it from entry.
+//
+// gorm.DB returned by GetDB before will not be usable anymore.
+func (entry *MySqlEntry) RemoveDatabase(name string) error {
+	entry.lock.Lock()
+
+	index := -1
+	for i, v := range entry.innerDbList {
+		if v.name == name {
+			index = i
 		}
+	}
 
-		entry.logger.delegate.Info(fmt.Sprintf("Connecting to database [%s]", innerDb.name))
-		dsn := fmt.Sprintf("%s:%s@%s(%s)/%s?%s",
-			entry.User, entry.pass, entry.Protocol, entry.Addr, innerDb.name, sqlParams)
+	if index < 0 {
+		entry.lock.Unlock()
+		return fmt.Errorf("database %s not found in MySqlEntry %s", name, entry.entryName)
+	}
 
-		db, err = gorm.Open(mysql.Open(dsn), entry.GormConfigMap[innerDb.name])
+	innerDbList := make([]*databaseInner, 0, len(entry.innerDbList)-1)
+	innerDbList = append(innerDbList, entry.innerDbList[:index]...)
+	entry.innerDbList = append(innerDbList, entry.innerDbList[index+1:]...)
 
-		// failed to connect to database
+	db, replicas := entry.GormDbMap[name], entry.replicaDbMap[name]
+	delete(entry.GormDbMap, name)
+	delete(entry.GormConfigMap, name)
+	delete(entry.replicaDbMap, name)
+	entry.lock.Unlock()
+
+	closeReplicas(replicas)
+	closeDB(db)
+
+	entry.logger.delegate.Info(fmt.Sprintf("Removing database [%s] success", name))
+
+	return nil
+}
+
+// Returns snapshot of databases, since databases could be added or removed at runtime
+func (entry *MySqlEntry) databases() []*databaseInner {
+	entry.lock.RLock()
+	defer entry.lock.RUnlock()
+
+	return append(make([]*databaseInner, 0, len(entry.innerDbList)), entry.innerDbList...)
+}
+
+// Returns gorm.Config of database with name
+func (entry *MySqlEntry) gormConfigOf(name string) *gorm.Config {
+	entry.lock.RLock()
+	defer entry.lock.RUnlock()
+
+	return entry.GormConfigMap[name]
+}
+
+// Create database if missing, password is masked in returned error.
+// Databases connected by previous attempt will be skipped.
+func (entry *MySqlEntry) connect(ctx context.Context) (err error) {
+	defer func() {
+		err = entry.redactError(err)
+	}()
+
+	for _, innerDb := range entry.databases() {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("connecting to database aborted, %w", err)
+		}
+
+		entry.lock.RLock()
+		_, ok := entry.GormDbMap[innerDb.name]
+		entry.lock.RUnlock()
+		if ok {
+			continue
+		}
+
+		db, replicas, err := entry.connectDatabase(ctx, innerDb, entry.gormConfigOf(innerDb.name))
 		if err != nil {
 			return err
 		}
 
-		for i := range innerDb.plugins {
-			if err := db.Use(innerDb.plugins[i]); err != nil {
-				return err
-			}
+		entry.lock.Lock()
+		// interrupted while connecting, connections stored before are closed by Interrupt
+		if entry.isInterrupted() {
+			entry.lock.Unlock()
+			closeReplicas(replicas)
+			closeDB(db)
+			return ErrInterrupted
 		}
-
 		entry.GormDbMap[innerDb.name] = db
-		entry.logger.delegate.Info(fmt.Sprintf("Connecting to database [%s] success", innerDb.name))
+		if len(replicas) > 0 {
+			entry.replicaDbMap[innerDb.name] = replicas
+		}
+		entry.lock.Unlock()
 	}
 
-	return nil
+	return entry.checkServerVersion(ctx)
 }
 
-// GetMySqlEntry returns MySqlEntry instance
-func GetMySqlEntry(name string) *MySqlEntry {
-	if raw := rkentry.GlobalAppCtx.GetEntry(MySqlEntryType, name); raw != nil {
-		if entry, ok := raw.(*MySqlEntry); ok {
-			return entry
+// Query version of server with the first database which is not in dry run mode, and compare it with minServerVersion
+func (entry *MySqlEntry) checkServerVersion(ctx context.Context) error {
+	var db *gorm.DB
+	entry.lock.RLock()
+	for _, innerDb := range entry.innerDbList {
+		if v, ok := entry.GormDbMap[innerDb.name]; ok && !innerDb.dryRun {
+			db = v
+			break
+		}
+	}
+	entry.lock.RUnlock()
+
+	if db == nil {
+		return nil
+	}
+
+	var version string
+	if err := db.WithContext(ctx).Raw("SELECT VERSION()").Scan(&version).Error; err != nil {
+		err = fmt.Errorf("failed to query server version, %w", err)
+		if len(entry.minServerVersion) > 0 && entry.minServerVersionErr {
+			return err
 		}
+		entry.logger.delegate.Warn("Failed to query server version, ignoring", zap.Error(entry.redactError(err)))
+		return nil
+	}
+
+	entry.lock.Lock()
+	entry.ServerVersion = version
+	entry.lock.Unlock()
+
+	entry.logger.delegate.Info("Connected to MySQL server", zap.String("serverVersion", version))
+
+	if len(entry.minServerVersion) < 1 {
+		return nil
+	}
+
+	actual, err := parseServerVersion(version)
+	if err != nil {
+		entry.logger.delegate.Warn("Failed to parse server version, skip checking minServerVersion", zap.Error(err))
+		return nil
 	}
 
+	expected, _ := parseServerVersion(entry.minServerVersion)
+	if compareServerVersion(actual, expected) >= 0 {
+		return nil
+	}
+
+	err = fmt.Errorf("server version %s of MySqlEntry %s is older than minServerVersion %s",
+		version, entry.entryName, entry.minServerVersion)
+	if entry.minServerVersionErr {
+		return err
+	}
+
+	entry.logger.delegate.Warn("Server is older than minServerVersion, ignoring", zap.Error(err))
 	return nil
 }
 
-// Make incoming paths to absolute path with current working directory attached as prefix
-func toAbsPath(p ...string) []string {
-	res := make([]string, 0)
+// Create database if missing, then connect to database and its replicas with current credentials
+func (entry *MySqlEntry) connectDatabase(ctx context.Context, innerDb *databaseInner, config *gorm.Config) (db *gorm.DB, replicas []*replicaDb, err error) {
+	sqlParams := strings.Join(entry.withTlsParam(innerDb.params), "&")
 
-	for i := range p {
-		if filepath.IsAbs(filepath.ToSlash(p[i])) || p[i] == "stdout" || p[i] == "stderr" {
-			res = append(res, p[i])
-			continue
+	// whether database is created by this call, seed data is loaded only into newly created database
+	created := false
+
+	// name of database in server, which is specified in raw DSN if provided
+	dbName := innerDb.name
+	if len(innerDb.dsn) > 0 {
+		if cfg, err := driver.ParseDSN(innerDb.dsn); err == nil && len(cfg.DBName) > 0 {
+			dbName = cfg.DBName
 		}
-		wd, _ := os.Getwd()
-		res = append(res, filepath.ToSlash(filepath.Join(wd, p[i])))
 	}
 
-	return res
+	// 1: create db if missing, skipped if dialector provided, or raw DSN provided without adminDsn
+	if !innerDb.dryRun && innerDb.autoCreate && innerDb.dialector == nil && (len(innerDb.dsn) < 1 || len(innerDb.adminDsn) > 0) {
+		msg := fmt.Sprintf("Creating database [%s]", dbName)
+		if len(innerDb.adminDsn) > 0 {
+			entry.logger.delegate.Info(msg, zap.String("dsn", redactDsn(innerDb.adminDsn)))
+			db, err = entry.openWithRetry(ctx, mysql.Open(innerDb.adminDsn), config)
+		} else {
+			db, err = entry.openOnNodes(ctx, msg, "", sqlParams, config)
+		}
+
+		// failed to connect to database
+		if err != nil {
+			closeDB(db)
+			return nil, nil, err
+		}
+
+		createSQL := fmt.Sprintf(
+			"CREATE DATABASE IF NOT EXISTS `%s` CHARACTER SET utf8mb4;",
+			dbName,
+		)
+
+		db = db.WithContext(ctx).Exec(createSQL)
+
+		if db.Error != nil {
+			closeDB(db)
+			return nil, nil, db.Error
+		}
+
+		// one row affected if created, zero with a warning if exists
+		created = db.RowsAffected > 0
+
+		closeDB(db)
+		entry.logger.delegate.Info(fmt.Sprintf("Creating database [%s] successs", innerDb.name),
+			zap.Bool("created", created))
+	}
+
+	// 2: connect with provided dialector or DSN
+	if innerDb.dialector != nil {
+		entry.logger.delegate.Info(fmt.Sprintf("Connecting to database [%s] with provided dialector", innerDb.name))
+		db, err = entry.openWithRetry(ctx, innerDb.dialector, config)
+	} else if len(innerDb.dsn) > 0 {
+		entry.logger.delegate.Info(fmt.Sprintf("Connecting to database [%s] with raw dsn", innerDb.name),
+			zap.String("dsn", redactDsn(innerDb.dsn)))
+		db, err = entry.openWithRetry(ctx, mysql.Open(innerDb.dsn), config)
+	} else {
+		db, err = entry.openOnNodes(ctx, fmt.Sprintf("Connecting to database [%s]", innerDb.name), innerDb.name, sqlParams, config)
+	}
+
+	// failed to connect to database
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := applyPool(innerDb, db); err != nil {
+		closeDB(db)
+		return nil, nil, err
+	}
+
+	// apply migrations before replicas, since replicas are expected to follow primary
+	if !innerDb.dryRun && innerDb.migrations != nil {
+		if err := entry.migrate(innerDb, db.WithContext(ctx)); err != nil {
+			closeDB(db)
+			return nil, nil, err
+		}
+	}
+
+	// load seed data into newly created database after migrations
+	if created && innerDb.seed != nil {
+		if err := entry.seedDatabase(innerDb, db.WithContext(ctx)); err != nil {
+			if innerDb.seed.fatal {
+				closeDB(db)
+				return nil, nil, err
+			}
+			entry.logger.delegate.Warn("Failed to seed database, ignoring", zap.Error(entry.redactError(err)))
+		}
+	}
+
+	// route read queries to replicas, plugins registered bellow will observe queries on replicas too
+	if len(innerDb.replicaAddrs) > 0 && innerDb.dialector == nil && len(innerDb.dsn) < 1 {
+		if replicas, err = entry.connectReplicas(ctx, innerDb, db, config, sqlParams); err != nil {
+			closeDB(db)
+			return nil, nil, err
+		}
+	}
+
+	for i := range innerDb.plugins {
+		if err := db.Use(innerDb.plugins[i]); err != nil {
+			closeDB(db)
+			closeReplicas(replicas)
+			return nil, nil, err
+		}
+	}
+
+	entry.logger.delegate.Info(fmt.Sprintf("Connecting to database [%s] success", innerDb.name))
+
+	return db, replicas, nil
+}
+
+// UpdateCredentials updates user and password of entry, call Reconnect to make it effective.
+// Empty values will be ignored.
+func (entry *MySqlEntry) UpdateCredentials(user, pass string) {
+	entry.credLock.Lock()
+	defer entry.credLock.Unlock()
+
+	if len(user) > 0 {
+		entry.User = user
+	}
+
+	if len(pass) > 0 {
+		entry.pass = pass
+	}
+}
+
+// Reconnect connects to all databases with current credentials and swaps new connections into GormDbMap.
+//
+// Previous connections will be closed after reconnectGraceMs, so gorm.DB fetched before keeps working until then,
+// and in-flight queries will be waited while closing. Call GetDB again after Reconnect to get the fresh gorm.DB.
+// Previous connections are kept if any of databases failed.
+func (entry *MySqlEntry) Reconnect(ctx context.Context) (err error) {
+	// driver errors may embed DSN, never expose password
+	defer func() {
+		err = entry.redactError(err)
+	}()
+
+	entry.connectLock.Lock()
+	defer entry.connectLock.Unlock()
+
+	entry.logger.delegate.Info("Reconnecting MySqlEntry", zap.String("entryName", entry.entryName))
+
+	gormDbMap := make(map[string]*gorm.DB)
+	replicaDbMap := make(map[string][]*replicaDb)
+
+	// close new connections if any of databases failed
+	defer func() {
+		if err != nil {
+			for _, db := range gormDbMap {
+				closeDB(db)
+			}
+			for _, replicas := range replicaDbMap {
+				closeReplicas(replicas)
+			}
+			entry.logger.delegate.Warn("Failed to reconnect MySqlEntry, previous connections kept",
+				zap.String("entryName", entry.entryName),
+				zap.Error(err))
+		}
+	}()
+
+	for _, innerDb := range entry.databases() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		db, replicas, err := entry.connectDatabase(ctx, innerDb, entry.gormConfigOf(innerDb.name))
+		if err != nil {
+			return err
+		}
+
+		gormDbMap[innerDb.name] = db
+		if len(replicas) > 0 {
+			replicaDbMap[innerDb.name] = replicas
+		}
+	}
+
+	entry.lock.Lock()
+	oldGormDbMap, oldReplicaDbMap := entry.GormDbMap, entry.replicaDbMap
+	entry.GormDbMap, entry.replicaDbMap = gormDbMap, replicaDbMap
+	entry.connected = true
+	entry.lock.Unlock()
+
+	entry.logger.delegate.Info("Reconnect MySqlEntry success",
+		zap.String("entryName", entry.entryName),
+		zap.Duration("closeOldConnectionsIn", entry.reconnectGrace))
+
+	// close old connections after grace period or entry interrupted
+	go func() {
+		timer := time.NewTimer(entry.reconnectGrace)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-entry.quitChannel:
+		}
+
+		for _, db := range oldGormDbMap {
+			closeDB(db)
+		}
+		for _, replicas := range oldReplicaDbMap {
+			closeReplicas(replicas)
+		}
+
+		entry.logger.delegate.Info("Closed old connections of MySqlEntry", zap.String("entryName", entry.entryName))
+	}()
+
+	return nil
+}
+
+// Connect to replicas of database and register them into dbresolver
+func (entry *MySqlEntry) connectReplicas(ctx context.Context, innerDb *databaseInner, db *gorm.DB, config *gorm.Config, sqlParams string) (replicas []*replicaDb, err error) {
+	dialectors := make([]gorm.Dialector, 0)
+
+	// close opened replicas if any of them failed
+	defer func() {
+		if err != nil {
+			closeReplicas(replicas)
+			replicas = nil
+		}
+	}()
+
+	for _, addr := range innerDb.replicaAddrs {
+		dsn, redactedDsn := entry.toDSN(addr, innerDb.name, sqlParams)
+		entry.logger.delegate.Info(fmt.Sprintf("Connecting to replica [%s] of database [%s]", addr, innerDb.name),
+			zap.String("dsn", redactedDsn))
+
+		replica, err := entry.openWithRetry(ctx, mysql.Open(dsn), config)
+		if err != nil {
+			return replicas, err
+		}
+
+		if err := applyPool(innerDb, replica); err != nil {
+			closeDB(replica)
+			return replicas, err
+		}
+
+		inner, _ := replica.DB()
+		replicas = append(replicas, &replicaDb{
+			addr: addr,
+			db:   inner,
+		})
+
+		// reuse the pool we opened, so that we are able to ping and close replicas by ourselves
+		dialectors = append(dialectors, mysql.New(mysql.Config{Conn: inner, SkipInitializeWithVersion: true}))
+		entry.logger.delegate.Info(fmt.Sprintf("Connecting to replica [%s] of database [%s] success", addr, innerDb.name))
+	}
+
+	var policy dbresolver.Policy = dbresolver.RandomPolicy{}
+	if innerDb.replicaPolicy == "roundrobin" {
+		policy = &roundRobinPolicy{}
+	}
+
+	return replicas, db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: dialectors,
+		Policy:   policy,
+	}))
+}
+
+// Open gorm.DB and retry transient failures with backoff if retry.maxAttempts is configured,
+// stop retrying once context canceled
+func (entry *MySqlEntry) openWithRetry(ctx context.Context, dialector gorm.Dialector, config *gorm.Config) (*gorm.DB, error) {
+	interval := entry.retryInterval
+
+	for attempt := 1; ; attempt++ {
+		db, err := openWithContext(ctx, dialector, config)
+		if err == nil {
+			return db, nil
+		}
+		closeDB(db)
+
+		if ctx.Err() != nil || attempt >= entry.retryMaxAttempts || !isTransientError(err) {
+			return nil, err
+		}
+
+		entry.logger.delegate.Warn(fmt.Sprintf("Failed to connect to database, retry in %s", interval),
+			zap.Int("attempt", attempt),
+			zap.Int("maxAttempts", entry.retryMaxAttempts),
+			zap.Error(entry.redactError(err)))
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("connecting to database aborted, %w", ctx.Err())
+		case <-time.After(interval):
+		}
+
+		if entry.retryMaxInterval > interval {
+			interval *= 2
+			if interval > entry.retryMaxInterval {
+				interval = entry.retryMaxInterval
+			}
+		}
+	}
+}
+
+// Open connection on nodes in order, the first reachable node becomes active node
+func (entry *MySqlEntry) openOnNodes(ctx context.Context, msg, dbName, sqlParams string, config *gorm.Config) (db *gorm.DB, err error) {
+	nodes := entry.Addrs
+	if len(nodes) < 1 {
+		nodes = []string{entry.activeAddr()}
+	}
+
+	for i, addr := range nodes {
+		dsn, redactedDsn := entry.toDSN(addr, dbName, sqlParams)
+		entry.logger.delegate.Info(msg, zap.String("dsn", redactedDsn))
+
+		if db, err = entry.openWithRetry(ctx, mysql.Open(dsn), config); err == nil {
+			entry.setActiveAddr(addr)
+			return db, nil
+		}
+
+		if ctx.Err() != nil || i == len(nodes)-1 {
+			break
+		}
+
+		entry.logger.delegate.Warn(fmt.Sprintf("Failed to connect to node [%s], trying next node", addr),
+			zap.Error(entry.redactError(err)))
+	}
+
+	return nil, err
+}
+
+// Returns address of active node
+func (entry *MySqlEntry) activeAddr() string {
+	entry.credLock.RLock()
+	defer entry.credLock.RUnlock()
+
+	return entry.Addr
+}
+
+// Switch active node, a warning is logged and nodeChanges increased if changed
+func (entry *MySqlEntry) setActiveAddr(addr string) {
+	entry.credLock.Lock()
+	prev := entry.Addr
+	entry.Addr = addr
+	entry.credLock.Unlock()
+
+	if prev == addr {
+		return
+	}
+
+	entry.logger.delegate.Warn("Active node of MySqlEntry changed",
+		zap.String("entryName", entry.entryName),
+		zap.String("from", prev),
+		zap.String("to", addr))
+
+	if entry.nodeChanges != nil {
+		entry.nodeChanges.WithLabelValues(prev, addr).Inc()
+	}
+}
+
+// Probe nodes before active node to fail back, reconnect if any of them is reachable or active node is unreachable
+func (entry *MySqlEntry) checkNodes() {
+	active := entry.activeAddr()
+
+	reconnect := false
+	for _, addr := range entry.Addrs {
+		err := entry.probeNode(addr)
+		if addr == active {
+			reconnect = err != nil
+			break
+		}
+		if err == nil {
+			reconnect = true
+			break
+		}
+	}
+
+	if !reconnect {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), entry.healthCheckInterval)
+	defer cancel()
+
+	if err := entry.Reconnect(ctx); err != nil {
+		entry.logger.delegate.Warn("Failed to switch node of MySqlEntry", zap.Error(err))
+	}
+}
+
+// Ping node with healthCheckTimeout without selecting database
+func (entry *MySqlEntry) probeNode(addr string) error {
+	dsn, _ := entry.toDSN(addr, "", strings.Join(entry.withTlsParam(nil), "&"))
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), entry.healthCheckTimeout)
+	defer cancel()
+
+	return db.PingContext(ctx)
+}
+
+// gorm.Open dials and pings without context, so it runs in background and is abandoned once ctx done,
+// connections opened after that will be closed. A ping bounded by ctx is sent after opened unless automatic ping disabled.
+func openWithContext(ctx context.Context, dialector gorm.Dialector, config *gorm.Config) (*gorm.DB, error) {
+	type result struct {
+		db  *gorm.DB
+		err error
+	}
+
+	// gorm.DB registers plugins into config, open with fresh copy so that
+	// plugins and dbresolver could be registered again while reconnecting
+	config = copyGormConfig(config)
+
+	ch := make(chan result, 1)
+	go func() {
+		db, err := gorm.Open(dialector, config)
+		ch <- result{db: db, err: err}
+	}()
+
+	var res result
+	select {
+	case res = <-ch:
+	case <-ctx.Done():
+		go func() {
+			closeDB((<-ch).db)
+		}()
+		return nil, fmt.Errorf("connecting to database aborted, %w", ctx.Err())
+	}
+
+	if res.err != nil {
+		return res.db, res.err
+	}
+
+	if config != nil && config.DisableAutomaticPing {
+		return res.db, nil
+	}
+
+	if sqlDb, err := res.db.DB(); err == nil {
+		if err := sqlDb.PingContext(ctx); err != nil {
+			if ctx.Err() != nil {
+				err = fmt.Errorf("connecting to database aborted, %w", err)
+			}
+			return res.db, err
+		}
+	}
+
+	return res.db, nil
+}
+
+// Errors returned from MySQL server, like access denied, won't be recovered by retrying,
+// except too many connections and server shutdown in progress
+func isTransientError(err error) bool {
+	var mysqlErr *driver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1040 || mysqlErr.Number == 1053
+	}
+
+	return true
+}
+
+// Build tls.Config from CertEntry based on tlsMode, system CA pool is used if CertEntry is not provided
+func (entry *MySqlEntry) toTlsConfig() (*tls.Config, error) {
+	res := &tls.Config{}
+
+	var rootCAs *x509.CertPool
+	if entry.certEntry != nil {
+		if entry.certEntry.Certificate != nil {
+			res.Certificates = []tls.Certificate{*entry.certEntry.Certificate}
+		}
+
+		if entry.certEntry.RootCA != nil {
+			rootCAs = x509.NewCertPool()
+			rootCAs.AddCert(entry.certEntry.RootCA)
+		}
+	}
+
+	switch entry.tlsMode {
+	case TlsModeSkipVerify:
+		res.InsecureSkipVerify = true
+	case TlsModeVerifyCA:
+		if entry.certEntry == nil {
+			return nil, fmt.Errorf("tlsMode %s requires CA in certEntry", entry.tlsMode)
+		}
+		if rootCAs == nil {
+			return nil, fmt.Errorf("tlsMode %s requires CA in certEntry %s", entry.tlsMode, entry.certEntry.GetName())
+		}
+		// verify certificate chain only, since host name verification is skipped by InsecureSkipVerify
+		res.InsecureSkipVerify = true
+		res.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyChain(rawCerts, rootCAs)
+		}
+	default:
+		res.RootCAs = rootCAs
+	}
+
+	return res, nil
+}
+
+// Verify certificates presented by server against root CAs without host name
+func verifyChain(rawCerts [][]byte, rootCAs *x509.CertPool) error {
+	if len(rawCerts) < 1 {
+		return errors.New("no certificate presented by server")
+	}
+
+	certs := make([]*x509.Certificate, 0)
+	for i := range rawCerts {
+		cert, err := x509.ParseCertificate(rawCerts[i])
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+
+	intermediates := x509.NewCertPool()
+	for i := range certs[1:] {
+		intermediates.AddCert(certs[i+1])
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         rootCAs,
+		Intermediates: intermediates,
+	})
+
+	return err
+}
+
+// Append tls param referencing registered TLS config unless user provided one
+func (entry *MySqlEntry) withTlsParam(params []string) []string {
+	if len(entry.tlsConfigName) < 1 {
+		return params
+	}
+
+	for i := range params {
+		if strings.HasPrefix(params[i], "tls=") {
+			return params
+		}
+	}
+
+	res := make([]string, 0, len(params)+1)
+	res = append(res, params...)
+	return append(res, "tls="+entry.tlsConfigName)
+}
+
+// Assign default addr based on protocol if missing
+func (entry *MySqlEntry) defaultAddr() {
+	if len(entry.Addr) > 0 {
+		return
+	}
+
+	entry.Addr = DefaultTcpAddr
+	if entry.Protocol == ProtocolUnix {
+		entry.Addr = DefaultUnixAddr
+	}
+}
+
+// Validate checks config of entry without connecting, all problems found are returned in one error.
+// It is called by RegisterMySqlEntry and RegisterMySqlEntryYAML.
+func (entry *MySqlEntry) Validate() error {
+	errs := make([]string, 0)
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	// protocol and addresses of primary, nodes and replicas
+	addrs := make([]string, 0)
+	switch entry.Protocol {
+	case ProtocolTcp, ProtocolUnix:
+		if len(entry.Addr) > 0 {
+			addrs = append(addrs, entry.Addr)
+		}
+		addrs = append(addrs, entry.Addrs...)
+		for _, innerDb := range entry.innerDbList {
+			addrs = append(addrs, innerDb.replicaAddrs...)
+		}
+	default:
+		addErr("invalid protocol %s of MySqlEntry %s, expect one of [%s, %s]",
+			entry.Protocol, entry.entryName, ProtocolTcp, ProtocolUnix)
+	}
+
+	for _, addr := range addrs {
+		if err := validateAddr(entry.Protocol, addr); err != nil {
+			addErr("invalid addr of MySqlEntry %s, %v", entry.entryName, err)
+		}
+	}
+
+	entry.credLock.RLock()
+	if len(entry.User) < 1 {
+		addErr("user of MySqlEntry %s must not be empty", entry.entryName)
+	}
+	entry.credLock.RUnlock()
+
+	switch entry.tlsMode {
+	case TlsModeVerifyCA:
+		if entry.certEntry == nil {
+			addErr("tlsMode %s of MySqlEntry %s requires certEntry with CA", entry.tlsMode, entry.entryName)
+		}
+	case TlsModeRequired, TlsModeSkipVerify:
+	default:
+		addErr("invalid tlsMode %s of MySqlEntry %s, expect one of [%s, %s, %s]",
+			entry.tlsMode, entry.entryName, TlsModeRequired, TlsModeVerifyCA, TlsModeSkipVerify)
+	}
+
+	if len(entry.minServerVersion) > 0 {
+		if _, err := parseServerVersion(entry.minServerVersion); err != nil {
+			addErr("invalid minServerVersion of MySqlEntry %s, %v", entry.entryName, err)
+		}
+	}
+
+	// numeric fields of entry
+	for _, v := range []struct {
+		key   string
+		value int64
+	}{
+		{"timeout", int64(entry.timeouts.dial)},
+		{"readTimeout", int64(entry.timeouts.read)},
+		{"writeTimeout", int64(entry.timeouts.write)},
+		{"retry.maxAttempts", int64(entry.retryMaxAttempts)},
+		{"retry.maxInterval", int64(entry.retryMaxInterval)},
+	} {
+		if v.value < 0 {
+			addErr("%s of MySqlEntry %s must not be negative", v.key, entry.entryName)
+		}
+	}
+
+	// databases
+	names := make(map[string]bool)
+	for _, innerDb := range entry.innerDbList {
+		if names[innerDb.name] {
+			addErr("duplicate database %s in MySqlEntry %s", innerDb.name, entry.entryName)
+		}
+		names[innerDb.name] = true
+
+		if len(innerDb.timeZone) > 0 {
+			if _, err := time.LoadLocation(innerDb.timeZone); err != nil {
+				addErr("invalid timeZone of database %s, %v", innerDb.name, err)
+			}
+		}
+
+		switch innerDb.replicaPolicy {
+		case "", "random", "roundrobin":
+		default:
+			addErr("invalid replica policy %s of database %s, expect one of [random, roundrobin]",
+				innerDb.replicaPolicy, innerDb.name)
+		}
+
+		for _, v := range []struct {
+			key   string
+			value int64
+		}{
+			{"maxIdleConn", int64(innerDb.maxIdleConn)},
+			{"maxOpenConn", int64(innerDb.maxOpenConn)},
+			{"connMaxLifetime", int64(innerDb.connMaxLifetime)},
+			{"connMaxIdleTime", int64(innerDb.connMaxIdleTime)},
+			{"timeout", int64(innerDb.timeouts.dial)},
+			{"readTimeout", int64(innerDb.timeouts.read)},
+			{"writeTimeout", int64(innerDb.timeouts.write)},
+		} {
+			if v.value < 0 {
+				addErr("%s of database %s must not be negative", v.key, innerDb.name)
+			}
+		}
+
+		for _, plugin := range innerDb.plugins {
+			if prom, ok := plugin.(*plugins.Prom); ok && prom.Conf != nil {
+				if err := prom.Conf.Table.Validate(); err != nil {
+					addErr("invalid table rewrite of prom plugin of database %s, %v", innerDb.name, err)
+				}
+			}
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errors.New(errs[0])
+	default:
+		return fmt.Errorf("invalid MySqlEntry %s, %s", entry.entryName, strings.Join(errs, "; "))
+	}
+}
+
+// Validate addr is host:port with tcp, or path of socket file with unix
+func validateAddr(protocol, addr string) error {
+	if protocol == ProtocolUnix {
+		if !strings.HasPrefix(addr, "/") {
+			return fmt.Errorf("%s is not an absolute path of socket file", addr)
+		}
+		return nil
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%s is not in form of host:port, %w", addr, err)
+	}
+
+	if len(host) < 1 {
+		return fmt.Errorf("%s is missing host", addr)
+	}
+
+	if num, err := strconv.Atoi(port); err != nil || num < 1 || num > 65535 {
+		return fmt.Errorf("%s has invalid port %s", addr, port)
+	}
+
+	return nil
+}
+
+// Build DSN like user:pass@tcp(localhost:3306)/dbName?params or user:pass@unix(/path/to/socket)/dbName?params,
+// password is masked in the redacted one which should be used for logging
+func (entry *MySqlEntry) toDSN(addr, dbName, sqlParams string) (dsn string, redacted string) {
+	format := "%s:%s@%s(%s)/%s?%s"
+
+	entry.credLock.RLock()
+	defer entry.credLock.RUnlock()
+
+	return fmt.Sprintf(format, entry.User, entry.pass, entry.Protocol, addr, dbName, sqlParams),
+		fmt.Sprintf(format, entry.User, "****", entry.Protocol, addr, dbName, sqlParams)
+}
+
+// redactedError masks password in message of wrapped error
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// Mask password of entry in DSN embedded in error message, like user:pass@tcp(host)/db,
+// other text is kept as it is, like "(using password: YES)" of server.
+func (entry *MySqlEntry) redactError(err error) error {
+	if err == nil {
+		return err
+	}
+
+	entry.credLock.RLock()
+	secrets := append([]string{entry.pass}, entry.dsnSecrets...)
+	entry.credLock.RUnlock()
+
+	msg := err.Error()
+	for _, secret := range secrets {
+		if len(secret) > 0 {
+			msg = strings.ReplaceAll(msg, ":"+secret+"@", ":****@")
+		}
+	}
+
+	if msg == err.Error() {
+		return err
+	}
+
+	return &redactedError{
+		err: err,
+		msg: msg,
+	}
+}
+
+// Mask password of raw DSN, the whole DSN is masked if it could not be parsed
+func redactDsn(dsn string) string {
+	cfg, err := driver.ParseDSN(dsn)
+	if err != nil {
+		return "****"
+	}
+
+	if len(cfg.Passwd) > 0 {
+		cfg.Passwd = "****"
+	}
+
+	return cfg.FormatDSN()
+}
+
+// Returns connection fields of entry which are configured with non default values
+func (entry *MySqlEntry) explicitConnFields() []string {
+	res := make([]string, 0)
+
+	entry.credLock.RLock()
+	defer entry.credLock.RUnlock()
+
+	if len(entry.Addr) > 0 {
+		res = append(res, "addr")
+	}
+	if entry.User != "root" {
+		res = append(res, "user")
+	}
+	if entry.pass != "pass" {
+		res = append(res, "pass")
+	}
+	if entry.Protocol != ProtocolTcp {
+		res = append(res, "protocol")
+	}
+
+	return res
+}
+
+// Validate raw DSN and adminDsn of database, passwords in them are recorded for redaction.
+// A warning is logged if fields ignored by raw DSN are configured.
+func (entry *MySqlEntry) validateDsn(innerDb *databaseInner, connFields []string) error {
+	for _, dsn := range []string{innerDb.dsn, innerDb.adminDsn} {
+		if len(dsn) < 1 {
+			continue
+		}
+
+		cfg, err := driver.ParseDSN(dsn)
+		if err != nil {
+			return fmt.Errorf("invalid dsn of database %s, %v", innerDb.name, entry.redactError(err))
+		}
+
+		if len(cfg.Passwd) > 0 {
+			entry.credLock.Lock()
+			entry.dsnSecrets = append(entry.dsnSecrets, cfg.Passwd)
+			entry.credLock.Unlock()
+		}
+	}
+
+	if innerDb.autoCreate && len(innerDb.adminDsn) < 1 {
+		return fmt.Errorf("autoCreate of database %s requires adminDsn if dsn provided", innerDb.name)
+	}
+
+	ignored := append([]string{}, connFields...)
+	if innerDb.rawParams || innerDb.statements != (statementParams{}) || len(innerDb.timeZone) > 0 {
+		ignored = append(ignored, "params")
+	}
+	if innerDb.timeouts != (timeouts{}) || entry.timeouts != (timeouts{}) {
+		ignored = append(ignored, "timeouts")
+	}
+	if len(innerDb.replicaAddrs) > 0 {
+		ignored = append(ignored, "replicas")
+	}
+
+	if len(ignored) > 0 {
+		entry.logger.delegate.Warn(fmt.Sprintf("Database [%s] is connected with raw dsn, ignoring %v", innerDb.name, ignored),
+			zap.String("dsn", redactDsn(innerDb.dsn)))
+	}
+
+	return nil
+}
+
+// Convert timeouts of database, or the ones of entry if missing, into DSN params.
+// Typed timeouts win over raw params with same key.
+func (entry *MySqlEntry) applyTimeouts(innerDb *databaseInner) error {
+	params := []struct {
+		key  string
+		db   time.Duration
+		base time.Duration
+	}{
+		{"timeout", innerDb.timeouts.dial, entry.timeouts.dial},
+		{"readTimeout", innerDb.timeouts.read, entry.timeouts.read},
+		{"writeTimeout", innerDb.timeouts.write, entry.timeouts.write},
+	}
+
+	for _, p := range params {
+		if p.db < 0 || p.base < 0 {
+			return fmt.Errorf("%s of database %s must not be negative", p.key, innerDb.name)
+		}
+
+		value := p.db
+		if value == 0 {
+			value = p.base
+		}
+
+		if value == 0 {
+			continue
+		}
+
+		newParams := make([]string, 0, len(innerDb.params)+1)
+		for i := range innerDb.params {
+			if strings.HasPrefix(innerDb.params[i], p.key+"=") {
+				entry.logger.delegate.Warn(fmt.Sprintf("Param [%s] of database [%s] is overridden by typed timeout", innerDb.params[i], innerDb.name),
+					zap.Duration(p.key, value))
+				continue
+			}
+			newParams = append(newParams, innerDb.params[i])
+		}
+
+		innerDb.params = append(newParams, fmt.Sprintf("%s=%dms", p.key, value.Milliseconds()))
+	}
+
+	return nil
+}
+
+// Convert typed statement params into params of DSN which win over raw params with same key.
+// multiStatements is rejected with prepareStmt, since prepared statement could not contain multiple statements.
+func (entry *MySqlEntry) applyStatementParams(innerDb *databaseInner, config *gorm.Config) error {
+	typed := map[string]bool{
+		"interpolateParams": innerDb.statements.interpolateParams,
+		"multiStatements":   innerDb.statements.multiStatements,
+	}
+
+	multiStatements := false
+	newParams := make([]string, 0, len(innerDb.params)+len(typed))
+	for i := range innerDb.params {
+		key, value, _ := strings.Cut(innerDb.params[i], "=")
+		if enabled, ok := typed[key]; ok && enabled {
+			entry.logger.delegate.Warn(fmt.Sprintf("Param [%s] of database [%s] is overridden by typed param", innerDb.params[i], innerDb.name),
+				zap.Bool(key, enabled))
+			continue
+		}
+		if key == "multiStatements" && strings.EqualFold(value, "true") {
+			multiStatements = true
+		}
+		newParams = append(newParams, innerDb.params[i])
+	}
+
+	for _, key := range []string{"interpolateParams", "multiStatements"} {
+		if typed[key] {
+			newParams = append(newParams, key+"=true")
+		}
+	}
+	innerDb.params = newParams
+
+	if !multiStatements && !innerDb.statements.multiStatements {
+		return nil
+	}
+
+	if config != nil && config.PrepareStmt {
+		return fmt.Errorf("multiStatements of database %s could not be enabled with prepareStmt", innerDb.name)
+	}
+
+	entry.logger.delegate.Warn(fmt.Sprintf("multiStatements enabled for database [%s], SQL injection could execute arbitrary statements, make sure all queries are parameterized", innerDb.name))
+
+	return nil
+}
+
+// Convert typed compat params into params of DSN ahead of raw params, raw params with same key are overridden.
+// Params are validated by driver, and a warning is logged if cleartext passwords allowed.
+func (entry *MySqlEntry) applyCompatParams(innerDb *databaseInner) error {
+	typed := make([]string, 0)
+	typedKeys := make(map[string]bool)
+	for _, p := range []struct {
+		key   string
+		value *bool
+	}{
+		{"allowNativePasswords", innerDb.compat.AllowNativePasswords},
+		{"allowCleartextPasswords", innerDb.compat.AllowCleartextPasswords},
+		{"compress", innerDb.compat.Compress},
+	} {
+		if p.value != nil {
+			typed = append(typed, fmt.Sprintf("%s=%t", p.key, *p.value))
+			typedKeys[p.key] = true
+		}
+	}
+
+	if len(typed) < 1 {
+		return nil
+	}
+
+	if _, err := driver.ParseDSN("/?" + strings.Join(typed, "&")); err != nil {
+		return fmt.Errorf("invalid params of database %s, %v", innerDb.name, err)
+	}
+
+	newParams := typed
+	for i := range innerDb.params {
+		key, _, _ := strings.Cut(innerDb.params[i], "=")
+		if typedKeys[key] {
+			entry.logger.delegate.Warn(fmt.Sprintf("Param [%s] of database [%s] is overridden by typed param", innerDb.params[i], innerDb.name))
+			continue
+		}
+		newParams = append(newParams, innerDb.params[i])
+	}
+	innerDb.params = newParams
+
+	if v := innerDb.compat.AllowCleartextPasswords; v != nil && *v {
+		// TLS enabled by cert entry, tlsMode or raw tls param
+		tls := entry.tlsEnabled
+		for i := range innerDb.params {
+			if strings.HasPrefix(innerDb.params[i], "tls=") && innerDb.params[i] != "tls=false" {
+				tls = true
+			}
+		}
+
+		fields := []zap.Field{zap.Bool("tls", tls)}
+		if !tls {
+			entry.logger.delegate.Warn(fmt.Sprintf("allowCleartextPasswords enabled for database [%s] without TLS, password will be sent in cleartext", innerDb.name), fields...)
+		} else {
+			entry.logger.delegate.Warn(fmt.Sprintf("allowCleartextPasswords enabled for database [%s], password will be sent in cleartext over TLS", innerDb.name), fields...)
+		}
+	}
+
+	return nil
+}
+
+// Convert time zone into loc param of DSN which wins over raw loc param
+func (entry *MySqlEntry) applyTimeZone(innerDb *databaseInner) error {
+	if len(innerDb.timeZone) < 1 {
+		return nil
+	}
+
+	if _, err := time.LoadLocation(innerDb.timeZone); err != nil {
+		return fmt.Errorf("invalid timeZone of database %s, %v", innerDb.name, err)
+	}
+
+	newParams := make([]string, 0, len(innerDb.params)+1)
+	for i := range innerDb.params {
+		if strings.HasPrefix(innerDb.params[i], "loc=") {
+			if innerDb.rawParams {
+				entry.logger.delegate.Warn(fmt.Sprintf("Param [%s] of database [%s] is overridden by timeZone", innerDb.params[i], innerDb.name),
+					zap.String("timeZone", innerDb.timeZone))
+			}
+			continue
+		}
+		newParams = append(newParams, innerDb.params[i])
+	}
+
+	innerDb.params = append(newParams, "loc="+url.QueryEscape(innerDb.timeZone))
+
+	return nil
+}
+
+// Returns time in UTC, used as NowFunc of gorm.Config if storeUTC enabled
+func nowUTC() time.Time {
+	return time.Now().UTC()
+}
+
+// Returns gorm.Config provided by WithGormConfig, or generated one from GormConfig
+func (entry *MySqlEntry) toGormConfig(innerDb *databaseInner) *gorm.Config {
+	if innerDb.gormConfig != nil {
+		if innerDb.gormConfig.Logger == nil {
+			innerDb.gormConfig.Logger = innerDb.logger
+		}
+		if innerDb.dryRun {
+			innerDb.gormConfig.DryRun = true
+		}
+		if innerDb.storeUTC && innerDb.gormConfig.NowFunc == nil {
+			innerDb.gormConfig.NowFunc = nowUTC
+		}
+		return innerDb.gormConfig
+	}
+
+	res := &gorm.Config{
+		Logger:                                   innerDb.logger,
+		DryRun:                                   innerDb.dryRun,
+		PrepareStmt:                              innerDb.gormOptions.PrepareStmt,
+		SkipDefaultTransaction:                   innerDb.gormOptions.SkipDefaultTransaction,
+		CreateBatchSize:                          innerDb.gormOptions.CreateBatchSize,
+		DisableForeignKeyConstraintWhenMigrating: innerDb.gormOptions.DisableForeignKeyConstraintWhenMigrating,
+		TranslateError:                           innerDb.gormOptions.TranslateError,
+	}
+
+	if innerDb.storeUTC {
+		res.NowFunc = nowUTC
+	}
+
+	// keep gorm default naming strategy if not configured
+	if len(innerDb.gormOptions.TablePrefix) > 0 || innerDb.gormOptions.SingularTable {
+		res.NamingStrategy = schema.NamingStrategy{
+			TablePrefix:   innerDb.gormOptions.TablePrefix,
+			SingularTable: innerDb.gormOptions.SingularTable,
+		}
+	}
+
+	return res
+}
+
+// Copy logger of entry for database and apply overrides, every database owns its own Logger instance
+func (entry *MySqlEntry) toDatabaseLogger(innerDb *databaseInner) *Logger {
+	res := *entry.logger
+
+	res.LogLevel = toGormLogLevel(innerDb.loggerOverride.Level, res.LogLevel)
+	if innerDb.loggerOverride.SlowThreshold > 0 {
+		res.SlowThreshold = innerDb.loggerOverride.SlowThreshold
+	}
+	if innerDb.loggerOverride.IgnoreRecordNotFoundError != nil {
+		res.IgnoreRecordNotFoundError = *innerDb.loggerOverride.IgnoreRecordNotFoundError
+	}
+
+	return &res
+}
+
+// Convert level string into gormLogger.LogLevel, default will be returned if level is unknown
+func toGormLogLevel(level string, def gormLogger.LogLevel) gormLogger.LogLevel {
+	switch level {
+	case "info":
+		return gormLogger.Info
+	case "warn":
+		return gormLogger.Warn
+	case "error":
+		return gormLogger.Error
+	case "silent":
+		return gormLogger.Silent
+	}
+
+	return def
+}
+
+// Returns databaseInner with name, nil if missing
+func (entry *MySqlEntry) getInnerDb(name string) *databaseInner {
+	for _, innerDb := range entry.databases() {
+		if innerDb.name == name {
+			return innerDb
+		}
+	}
+
+	return nil
+}
+
+// Returns database targeted by pool option, option referencing unknown database will be ignored with a debug log
+func (entry *MySqlEntry) poolInnerDb(name, option string) *databaseInner {
+	inner := entry.getInnerDb(name)
+	if inner == nil {
+		entry.logger.delegate.Debug(fmt.Sprintf("Ignoring %s of unknown database [%s]", option, name),
+			zap.String("entryName", entry.entryName))
+	}
+
+	return inner
+}
+
+// Parse leading numbers of version like 8.0.32, 5.7.41-log and 10.11.2-MariaDB-1:10.11.2+maria~ubu2204.
+// Prefix 5.5.5- of MariaDB which is added for replication compatibility will be removed.
+func parseServerVersion(in string) ([]int, error) {
+	version := strings.TrimSpace(in)
+	if strings.Contains(version, "MariaDB") {
+		version = strings.TrimPrefix(version, "5.5.5-")
+	}
+
+	if end := strings.IndexFunc(version, func(r rune) bool {
+		return r != '.' && (r < '0' || r > '9')
+	}); end >= 0 {
+		version = version[:end]
+	}
+
+	res := make([]int, 0)
+	for _, part := range strings.Split(strings.TrimSuffix(version, "."), ".") {
+		num, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server version %q", in)
+		}
+		res = append(res, num)
+	}
+
+	return res, nil
+}
+
+// Compare versions part by part, missing parts are treated as zero
+func compareServerVersion(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// Read password from file, surrounding whitespaces and trailing newline will be trimmed.
+// Error will be returned if file is missing or empty.
+func readPassFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	pass := strings.TrimSpace(string(content))
+	if len(pass) < 1 {
+		return "", fmt.Errorf("password file %s is empty", path)
+	}
+
+	return pass, nil
+}
+
+// Expand ${NAME} and ${NAME:-default} with environment variables, $$ is escaped as a literal $.
+//
+// Error will be returned if variable is not set and no default value provided.
+func expandEnv(in string) (string, error) {
+	res := strings.Builder{}
+
+	for i := 0; i < len(in); i++ {
+		if in[i] != '$' || i+1 >= len(in) {
+			res.WriteByte(in[i])
+			continue
+		}
+
+		switch in[i+1] {
+		case '$':
+			res.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(in[i+2:], '}')
+			if end < 0 {
+				// do not print input which may be password
+				return "", fmt.Errorf("missing closing brace of variable at position %d", i)
+			}
+
+			name, def, hasDef := strings.Cut(in[i+2:i+2+end], ":-")
+			if val, ok := os.LookupEnv(name); ok {
+				res.WriteString(val)
+			} else if hasDef {
+				res.WriteString(def)
+			} else {
+				return "", fmt.Errorf("environment variable %s is not set", name)
+			}
+			i += end + 2
+		default:
+			res.WriteByte(in[i])
+		}
+	}
+
+	return res.String(), nil
+}
+
+// Apply connection pool settings of database, Go defaults will be kept for non-positive values
+func applyPool(innerDb *databaseInner, db *gorm.DB) error {
+	inner, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	if innerDb.maxIdleConn > 0 {
+		inner.SetMaxIdleConns(innerDb.maxIdleConn)
+	}
+
+	if innerDb.maxOpenConn > 0 {
+		inner.SetMaxOpenConns(innerDb.maxOpenConn)
+	}
+
+	if innerDb.connMaxLifetime > 0 {
+		inner.SetConnMaxLifetime(innerDb.connMaxLifetime)
+	}
+
+	if innerDb.connMaxIdleTime > 0 {
+		inner.SetConnMaxIdleTime(innerDb.connMaxIdleTime)
+	}
+
+	return nil
+}
+
+// GetMySqlEntry returns MySqlEntry instance, names of registered entries are logged with debug level if missing
+func GetMySqlEntry(name string) *MySqlEntry {
+	if raw := rkentry.GlobalAppCtx.GetEntry(MySqlEntryType, name); raw != nil {
+		if entry, ok := raw.(*MySqlEntry); ok {
+			return entry
+		}
+	}
+
+	names := make([]string, 0)
+	for _, entry := range GetMySqlEntries() {
+		names = append(names, entry.GetName())
+	}
+
+	rkentry.GlobalAppCtx.GetLoggerEntryDefault().Logger.Debug(fmt.Sprintf("MySqlEntry [%s] not found", name),
+		zap.Strings("knownEntries", names))
+
+	return nil
+}
+
+// GetMySqlEntries returns all registered MySqlEntry instances ordered by name
+func GetMySqlEntries() []*MySqlEntry {
+	res := make([]*MySqlEntry, 0)
+	for _, raw := range rkentry.GlobalAppCtx.ListEntriesByType(MySqlEntryType) {
+		if entry, ok := raw.(*MySqlEntry); ok {
+			res = append(res, entry)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].GetName() < res[j].GetName()
+	})
+
+	return res
+}
+
+// GetMySqlEntryDefault returns MySqlEntry if exactly one registered, nil otherwise
+func GetMySqlEntryDefault() *MySqlEntry {
+	if entries := GetMySqlEntries(); len(entries) == 1 {
+		return entries[0]
+	}
+
+	return nil
+}
+
+// GetGormDb returns gorm.DB with entry name and database name, nil will be returned if either is missing
+func GetGormDb(entryName, dbName string) *gorm.DB {
+	if entry := GetMySqlEntry(entryName); entry != nil {
+		return entry.GetDB(dbName)
+	}
+
+	return nil
+}
+
+// Make incoming paths to absolute path with current working directory attached as prefix
+func toAbsPath(p ...string) []string {
+	res := make([]string, 0)
+
+	for i := range p {
+		if filepath.IsAbs(filepath.ToSlash(p[i])) || p[i] == "stdout" || p[i] == "stderr" {
+			res = append(res, p[i])
+			continue
+		}
+		wd, _ := os.Getwd()
+		res = append(res, filepath.ToSlash(filepath.Join(wd, p[i])))
+	}
+
+	return res
+}
+
+// Copy gorm.Config with empty plugins
+func copyGormConfig(config *gorm.Config) *gorm.Config {
+	res := &gorm.Config{}
+	if config != nil {
+		*res = *config
+	}
+	res.Plugins = map[string]gorm.Plugin{}
+
+	return res
+}
+
+func closeReplicas(replicas []*replicaDb) {
+	for _, replica := range replicas {
+		replica.db.Close()
+	}
 }
 
 func closeDB(db *gorm.DB) {
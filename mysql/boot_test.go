@@ -6,9 +6,35 @@ package rkmysql
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rookie-ninja/rk-db/mysql/plugins"
 	"github.com/rookie-ninja/rk-entry/v2/entry"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+	"gorm.io/plugin/dbresolver"
+	"math/big"
+	"os"
+	"path"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRegisterMySqlEntry(t *testing.T) {
@@ -35,8 +61,8 @@ func TestRegisterMySqlEntry(t *testing.T) {
 		WithDescription("ut-entry"),
 		WithUser("ut-user"),
 		WithPass("ut-pass"),
-		WithProtocol("ut-protocol"),
-		WithAddr("ut-addr"),
+		WithProtocol("unix"),
+		WithAddr("/ut/mysqld.sock"),
 		WithDatabase("ut-database", true, false))
 
 	assert.Equal(t, "ut-entry", entry.GetName())
@@ -45,8 +71,8 @@ func TestRegisterMySqlEntry(t *testing.T) {
 	assert.NotEmpty(t, entry.String())
 	assert.Equal(t, "ut-user", entry.User)
 	assert.Equal(t, "ut-pass", entry.pass)
-	assert.Equal(t, "ut-protocol", entry.Protocol)
-	assert.Equal(t, "ut-addr", entry.Addr)
+	assert.Equal(t, "unix", entry.Protocol)
+	assert.Equal(t, "/ut/mysqld.sock", entry.Addr)
 	assert.Empty(t, entry.GormDbMap)
 	assert.NotEmpty(t, entry.GormConfigMap)
 
@@ -78,6 +104,42 @@ func TestGetMySqlEntry(t *testing.T) {
 	assert.Equal(t, entry, GetMySqlEntry(entry.GetName()))
 }
 
+func TestGetMySqlEntries(t *testing.T) {
+	// start without entries leaked by other tests
+	for _, entry := range GetMySqlEntries() {
+		rkentry.GlobalAppCtx.RemoveEntry(entry)
+	}
+
+	assert.Empty(t, GetMySqlEntries())
+	assert.Nil(t, GetMySqlEntryDefault())
+
+	// exactly one
+	first := RegisterMySqlEntry(WithName("ut-entry-b"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(first)
+	assert.Equal(t, []*MySqlEntry{first}, GetMySqlEntries())
+	assert.Same(t, first, GetMySqlEntryDefault())
+
+	// ambiguous with more than one
+	second := RegisterMySqlEntry(WithName("ut-entry-a"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(second)
+	assert.Equal(t, []*MySqlEntry{second, first}, GetMySqlEntries())
+	assert.Nil(t, GetMySqlEntryDefault())
+
+	// known entries logged if missing
+	core, logs := observer.New(zap.DebugLevel)
+	loggerEntry := rkentry.GlobalAppCtx.GetLoggerEntryDefault()
+	prev := loggerEntry.Logger
+	loggerEntry.Logger = zap.New(core)
+	defer func() {
+		loggerEntry.Logger = prev
+	}()
+
+	assert.Nil(t, GetMySqlEntry("ut-entry-c"))
+	missing := logs.FilterMessage("MySqlEntry [ut-entry-c] not found").All()
+	assert.Len(t, missing, 1)
+	assert.Equal(t, []interface{}{"ut-entry-a", "ut-entry-b"}, missing[0].ContextMap()["knownEntries"])
+}
+
 func TestRegisterMySqlEntriesWithConfig(t *testing.T) {
 	bootConfigStr := `
 mysql:
@@ -104,11 +166,1647 @@ mysql:
 	rkentry.GlobalAppCtx.RemoveEntry(entries["user-db"])
 }
 
+func TestRegisterMySqlEntry_Pool(t *testing.T) {
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    database:
+      - name: ut-database
+        maxIdleConn: 5
+        maxOpenConn: 20
+        connMaxLifetimeMs: 60000
+        connMaxIdleTimeMs: 30000
+      - name: ut-default
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-entry"].(*MySqlEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	innerDb := entry.getInnerDb("ut-database")
+	assert.Equal(t, 5, innerDb.maxIdleConn)
+	assert.Equal(t, 20, innerDb.maxOpenConn)
+	assert.Equal(t, time.Minute, innerDb.connMaxLifetime)
+	assert.Equal(t, 30*time.Second, innerDb.connMaxIdleTime)
+
+	innerDb = entry.getInnerDb("ut-default")
+	assert.Zero(t, innerDb.maxIdleConn)
+	assert.Zero(t, innerDb.maxOpenConn)
+
+	// apply to sql.DB without connecting
+	sqlDb, err := sql.Open("mysql", "root:pass@tcp(localhost:3306)/ut-database")
+	assert.Nil(t, err)
+	defer sqlDb.Close()
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDb, SkipInitializeWithVersion: true}),
+		&gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err)
+
+	assert.Nil(t, applyPool(entry.getInnerDb("ut-database"), db))
+	assert.Equal(t, 20, sqlDb.Stats().MaxOpenConnections)
+
+	// code based options, unknown database ignored
+	entry = RegisterMySqlEntry(
+		WithName("ut-options"),
+		WithDatabase("ut-database", true, false),
+		WithMaxOpenConn("ut-database", 10),
+		WithMaxOpenConn("ut-missing", 10))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	assert.Equal(t, 10, entry.getInnerDb("ut-database").maxOpenConn)
+	assert.Nil(t, entry.getInnerDb("ut-missing"))
+
+	// debug log of unknown database
+	core, logs := observer.New(zap.DebugLevel)
+	entry = RegisterMySqlEntry(
+		WithName("ut-unknown"),
+		WithLogger(&Logger{delegate: zap.New(core)}),
+		WithMaxIdleConn("ut-missing", 1),
+		WithConnMaxLifetime("ut-missing", time.Minute))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	assert.Equal(t, 1, logs.FilterMessage("Ignoring WithMaxIdleConn of unknown database [ut-missing]").Len())
+	assert.Equal(t, 1, logs.FilterMessage("Ignoring WithConnMaxLifetime of unknown database [ut-missing]").Len())
+}
+
+func TestMySqlEntry_HealthCheck(t *testing.T) {
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    healthCheck:
+      enabled: true
+      intervalMs: 20
+      timeoutMs: 100
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-entry"].(*MySqlEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.True(t, entry.healthCheckEnabled)
+	assert.Equal(t, 20*time.Millisecond, entry.healthCheckInterval)
+	assert.Equal(t, 100*time.Millisecond, entry.healthCheckTimeout)
+
+	// nothing listening on port 1
+	sqlDb, err := sql.Open("mysql", "root:pass@tcp(127.0.0.1:1)/ut-database")
+	assert.Nil(t, err)
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDb, SkipInitializeWithVersion: true}),
+		&gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err)
+	entry.GormDbMap["ut-database"] = db
+
+	core, logs := observer.New(zap.WarnLevel)
+	entry.logger = &Logger{delegate: zap.New(core)}
+
+	entry.Bootstrap(context.TODO())
+	assert.Eventually(t, func() bool {
+		return logs.FilterMessage("MySqlEntry is unhealthy").Len() > 0
+	}, time.Second, 10*time.Millisecond)
+
+	entry.Interrupt(context.TODO())
+}
+
+func TestMySqlEntry_Interrupt(t *testing.T) {
+	entry := RegisterMySqlEntry(
+		WithName("ut-interrupt"),
+		WithDatabase("ut-database", false, false))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	sqlDb, err := sql.Open("mysql", "root:pass@tcp(127.0.0.1:1)/ut-database")
+	assert.Nil(t, err)
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDb, SkipInitializeWithVersion: true}),
+		&gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err)
+	entry.GormDbMap["ut-database"] = db
+
+	entry.Interrupt(context.TODO())
+
+	err = sqlDb.Ping()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "database is closed")
+
+	// idempotent
+	assert.NotPanics(t, func() {
+		entry.Interrupt(context.TODO())
+	})
+}
+
+func TestMySqlEntry_Reconnect(t *testing.T) {
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    addr: "127.0.0.1:1"
+    user: ut-user
+    pass: ut-old-pass
+    reconnectGraceMs: 100
+    database:
+      - name: ut-database
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	assert.NotEmpty(t, entries)
+
+	entry := GetMySqlEntry("ut-entry")
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.Equal(t, 100*time.Millisecond, entry.reconnectGrace)
+
+	// empty values should be ignored
+	entry.UpdateCredentials("", "ut-new-pass")
+	assert.Equal(t, "ut-user", entry.User)
+	assert.Equal(t, "ut-new-pass", entry.pass)
+
+	// previous connections
+	sqlDb, err := sql.Open("mysql", "ut-user:ut-old-pass@tcp(127.0.0.1:1)/ut-database")
+	assert.Nil(t, err)
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDb, SkipInitializeWithVersion: true}),
+		&gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err)
+	entry.GormDbMap["ut-database"] = db
+
+	// failed reconnect should keep previous connections and never expose password
+	err = entry.Reconnect(context.TODO())
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "ut-new-pass")
+	assert.Equal(t, db, entry.GetDB("ut-database"))
+
+	// canceled context
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	assert.ErrorIs(t, entry.Reconnect(ctx), context.Canceled)
+	assert.Equal(t, db, entry.GetDB("ut-database"))
+
+	// default grace
+	entry = RegisterMySqlEntry(WithName("ut-default-grace"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	assert.Equal(t, 30*time.Second, entry.reconnectGrace)
+}
+
+func TestMySqlEntry_ReconnectWithPlugins(t *testing.T) {
+	mockDb, _, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer mockDb.Close()
+
+	entry := RegisterMySqlEntry(WithName("ut-reconnect-plugins"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	entry.Bootstrap(context.TODO())
+	defer entry.Interrupt(context.TODO())
+
+	plugin := &utPlugin{}
+	assert.Nil(t, entry.AddDatabase(context.TODO(), "ut-database",
+		WithDbDialector(mysql.New(mysql.Config{Conn: mockDb, SkipInitializeWithVersion: true})),
+		WithDbPlugin(plugin)))
+	assert.True(t, plugin.initialized)
+	oldDb := entry.GetDB("ut-database")
+
+	// plugin is registered again
+	for i := 0; i < 2; i++ {
+		plugin.initialized = false
+		assert.Nil(t, entry.Reconnect(context.TODO()))
+		assert.True(t, plugin.initialized)
+		assert.NotSame(t, oldDb, entry.GetDB("ut-database"))
+	}
+}
+
+func TestCopyGormConfig(t *testing.T) {
+	config := &gorm.Config{DisableAutomaticPing: true}
+
+	// plugins registered by opened gorm.DB won't be kept in config
+	for i := 0; i < 2; i++ {
+		mockDb, _, err := sqlmock.New()
+		assert.Nil(t, err)
+		db, err := gorm.Open(mysql.New(mysql.Config{Conn: mockDb, SkipInitializeWithVersion: true}), copyGormConfig(config))
+		assert.Nil(t, err)
+		assert.Nil(t, db.Use(dbresolver.Register(dbresolver.Config{})))
+		assert.Len(t, db.Config.Plugins, 1)
+		mockDb.Close()
+	}
+	assert.Empty(t, config.Plugins)
+	assert.True(t, copyGormConfig(config).DisableAutomaticPing)
+	assert.NotNil(t, copyGormConfig(nil))
+}
+
+func TestMySqlEntry_AddDatabase(t *testing.T) {
+	mockDb, _, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer mockDb.Close()
+
+	entry := RegisterMySqlEntry(
+		WithName("ut-add-database"),
+		WithTimeouts(time.Second, 0, 0))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// empty name
+	assert.NotNil(t, entry.AddDatabase(context.TODO(), ""))
+
+	// concurrent readers never see half-initialized database
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-quit:
+				return
+			default:
+				if db, err := entry.GetDBE("ut-tenant"); err == nil {
+					assert.NotNil(t, db)
+				}
+				entry.GetDBList()
+			}
+		}
+	}()
+
+	// add database
+	plugin := &utPlugin{}
+	assert.Nil(t, entry.AddDatabase(context.TODO(), "ut-tenant",
+		WithDbDialector(mysql.New(mysql.Config{Conn: mockDb, SkipInitializeWithVersion: true})),
+		WithDbPool(1, 2),
+		WithDbPlugin(plugin),
+		WithDbGormConfig(GormConfig{SingularTable: true})))
+	close(quit)
+	<-done
+
+	db := entry.GetDB("ut-tenant")
+	assert.NotNil(t, db)
+	assert.Same(t, db, entry.GetDefaultDB())
+	assert.True(t, plugin.initialized)
+	assert.Equal(t, 2, entry.innerDbList[0].maxOpenConn)
+	assert.Equal(t, []string{"charset=utf8mb4", "parseTime=True", "loc=Local", "timeout=1000ms"}, entry.innerDbList[0].params)
+
+	// logger of entry
+	config := entry.GormConfigMap["ut-tenant"]
+	assert.Equal(t, entry.logger, config.Logger)
+	assert.Equal(t, schema.NamingStrategy{SingularTable: true}, config.NamingStrategy)
+
+	// duplicate database
+	assert.NotNil(t, entry.AddDatabase(context.TODO(), "ut-tenant"))
+
+	// canceled context
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	assert.ErrorIs(t, entry.AddDatabase(ctx, "ut-canceled"), context.Canceled)
+
+	// remove database
+	assert.Nil(t, entry.RemoveDatabase("ut-tenant"))
+	assert.Nil(t, entry.GetDB("ut-tenant"))
+	assert.Empty(t, entry.innerDbList)
+	assert.Empty(t, entry.GormConfigMap)
+	assert.NotNil(t, mockDb.Ping())
+	assert.NotNil(t, entry.RemoveDatabase("ut-tenant"))
+}
+
+// utPlugin records whether it is initialized
+type utPlugin struct {
+	initialized bool
+}
+
+func (p *utPlugin) Name() string {
+	return "ut-plugin"
+}
+
+func (p *utPlugin) Initialize(*gorm.DB) error {
+	p.initialized = true
+	return nil
+}
+
+func TestMySqlEntry_HealthStatus(t *testing.T) {
+	healthyDb, _, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer healthyDb.Close()
+
+	// black-holed network
+	slowDb, slowMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.Nil(t, err)
+	defer slowDb.Close()
+	slowMock.ExpectPing().WillDelayFor(5 * time.Second)
+
+	// nothing listening on port 1
+	replicaSqlDb, err := sql.Open("mysql", "root:pass@tcp(127.0.0.1:1)/ut-healthy")
+	assert.Nil(t, err)
+
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    healthCheck:
+      timeoutMs: 50
+    database:
+      - name: ut-healthy
+      - name: ut-slow
+      - name: ut-lazy
+`
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-entry"].(*MySqlEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// timeout is configurable without enabling health check
+	assert.False(t, entry.healthCheckEnabled)
+	assert.Equal(t, 50*time.Millisecond, entry.healthCheckTimeout)
+
+	for name, db := range map[string]*sql.DB{"ut-healthy": healthyDb, "ut-slow": slowDb} {
+		gormDb, err := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}),
+			&gorm.Config{DisableAutomaticPing: true})
+		assert.Nil(t, err)
+		entry.GormDbMap[name] = gormDb
+	}
+	entry.replicaDbMap["ut-healthy"] = []*replicaDb{{addr: "127.0.0.1:1", db: replicaSqlDb}}
+	entry.connected = true
+
+	start := time.Now()
+	res := entry.HealthStatus()
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Len(t, res, 4)
+
+	assert.True(t, res["ut-healthy"].Healthy)
+	assert.Nil(t, res["ut-healthy"].Err)
+	assert.False(t, res["ut-healthy"].CheckedAt.IsZero())
+
+	assert.False(t, res["ut-slow"].Healthy)
+	assert.NotNil(t, res["ut-slow"].Err)
+	assert.GreaterOrEqual(t, res["ut-slow"].Latency, 50*time.Millisecond)
+
+	assert.False(t, res["ut-healthy/127.0.0.1:1"].Healthy)
+	assert.NotNil(t, res["ut-healthy/127.0.0.1:1"].Err)
+
+	assert.ErrorIs(t, res["ut-lazy"].Err, ErrNotConnected)
+
+	// derived
+	assert.False(t, entry.IsHealthy())
+
+	// safe to call concurrently
+	done := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		go func() {
+			entry.HealthStatus()
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+}
+
+func TestMySqlEntry_CheckServerVersion(t *testing.T) {
+	newEntry := func(t *testing.T, version string, opts ...Option) *MySqlEntry {
+		mockDb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		assert.Nil(t, err)
+		t.Cleanup(func() { mockDb.Close() })
+		mock.ExpectQuery("SELECT VERSION()").
+			WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow(version))
+
+		db, err := gorm.Open(mysql.New(mysql.Config{Conn: mockDb, SkipInitializeWithVersion: true}),
+			&gorm.Config{DisableAutomaticPing: true})
+		assert.Nil(t, err)
+
+		entry := RegisterMySqlEntry(append([]Option{
+			WithName("ut-server-version"),
+			WithDatabase("ut-database", false, false),
+		}, opts...)...)
+		t.Cleanup(func() { rkentry.GlobalAppCtx.RemoveEntry(entry) })
+		entry.GormDbMap["ut-database"] = db
+
+		return entry
+	}
+
+	// without min version
+	entry := newEntry(t, "8.0.32")
+	assert.Nil(t, entry.checkServerVersion(context.TODO()))
+	assert.Equal(t, "8.0.32", entry.GetServerVersion())
+	assert.Contains(t, entry.GetDescription(), "serverVersion:8.0.32")
+	assert.Contains(t, entry.String(), `"serverVersion":"8.0.32"`)
+
+	// older server with fatal
+	entry = newEntry(t, "5.6.51-log", WithMinServerVersion("8.0", true))
+	err := entry.checkServerVersion(context.TODO())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "older than minServerVersion 8.0")
+
+	// older server with warning
+	entry = newEntry(t, "5.6.51", WithMinServerVersion("8.0", false))
+	core, logs := observer.New(zap.WarnLevel)
+	entry.logger = &Logger{delegate: zap.New(core)}
+	assert.Nil(t, entry.checkServerVersion(context.TODO()))
+	assert.Equal(t, 1, logs.FilterMessage("Server is older than minServerVersion, ignoring").Len())
+	assert.Equal(t, "5.6.51", entry.GetServerVersion())
+
+	// MariaDB
+	entry = newEntry(t, "5.5.5-10.11.2-MariaDB-1:10.11.2+maria~ubu2204", WithMinServerVersion("10.6", true))
+	assert.Nil(t, entry.checkServerVersion(context.TODO()))
+
+	// invalid min version
+	assert.Panics(t, func() {
+		RegisterMySqlEntry(WithName("ut-invalid-version"), WithMinServerVersion("latest", true))
+	})
+}
+
+func TestParseServerVersion(t *testing.T) {
+	for in, expect := range map[string][]int{
+		"8.0":                       {8, 0},
+		"8.0.32":                    {8, 0, 32},
+		"5.7.41-log":                {5, 7, 41},
+		" 8.0.32-0ubuntu0.22.04.2 ": {8, 0, 32},
+		"10.11.2-MariaDB-1:10.11.2+maria~ubu2204":       {10, 11, 2},
+		"5.5.5-10.11.2-MariaDB-1:10.11.2+maria~ubu2204": {10, 11, 2},
+	} {
+		version, err := parseServerVersion(in)
+		assert.Nil(t, err, in)
+		assert.Equal(t, expect, version, in)
+	}
+
+	_, err := parseServerVersion("latest")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, 0, compareServerVersion([]int{8, 0}, []int{8, 0, 0}))
+	assert.Equal(t, -1, compareServerVersion([]int{5, 7, 41}, []int{8, 0}))
+	assert.Equal(t, 1, compareServerVersion([]int{8, 0, 13}, []int{8, 0}))
+}
+
+func TestMySqlEntry_TlsConfig(t *testing.T) {
+	ca, caKey := newCert(t, nil, nil, true)
+	leaf, _ := newCert(t, ca, caKey, false)
+
+	certEntry := &rkentry.CertEntry{RootCA: ca}
+
+	// required
+	entry := RegisterMySqlEntry(WithName("ut-tls"), WithCertEntry(certEntry))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	assert.Equal(t, TlsModeRequired, entry.tlsMode)
+	tlsConfig, err := entry.toTlsConfig()
+	assert.Nil(t, err)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Empty(t, tlsConfig.Certificates)
+
+	// verify-ca, host name of leaf is not verified
+	entry.tlsMode = TlsModeVerifyCA
+	tlsConfig, err = entry.toTlsConfig()
+	assert.Nil(t, err)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+	assert.Nil(t, tlsConfig.VerifyPeerCertificate([][]byte{leaf.Raw}, nil))
+	other, _ := newCert(t, nil, nil, true)
+	assert.NotNil(t, tlsConfig.VerifyPeerCertificate([][]byte{other.Raw}, nil))
+	assert.NotNil(t, tlsConfig.VerifyPeerCertificate(nil, nil))
+
+	// verify-ca without CA
+	entry.certEntry = &rkentry.CertEntry{Certificate: &tls.Certificate{}}
+	_, err = entry.toTlsConfig()
+	assert.NotNil(t, err)
+
+	// skip-verify with client certificate
+	entry.tlsMode = TlsModeSkipVerify
+	tlsConfig, err = entry.toTlsConfig()
+	assert.Nil(t, err)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+	assert.Len(t, tlsConfig.Certificates, 1)
+
+	// tls param
+	assert.Equal(t, []string{"charset=utf8mb4"}, entry.withTlsParam([]string{"charset=utf8mb4"}))
+	entry.tlsConfigName = "rk-ut-tls"
+	assert.Equal(t, []string{"charset=utf8mb4", "tls=rk-ut-tls"}, entry.withTlsParam([]string{"charset=utf8mb4"}))
+	assert.Equal(t, []string{"tls=false"}, entry.withTlsParam([]string{"tls=false"}))
+
+	// invalid tls mode
+	assert.Panics(t, func() {
+		RegisterMySqlEntry(WithName("ut-invalid-tls"), WithTlsMode("verify-full"))
+	})
+}
+
+func TestMySqlEntry_TlsModeWithoutCertEntry(t *testing.T) {
+	// TLS is disabled by default
+	entry := RegisterMySqlEntry(WithName("ut-plain"))
+	assert.False(t, entry.tlsEnabled)
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// tlsMode enables TLS with system CA pool
+	entry = RegisterMySqlEntry(WithName("ut-tls-mode"), WithTlsMode(TlsModeSkipVerify), WithLazy())
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	assert.True(t, entry.tlsEnabled)
+	tlsConfig, err := entry.toTlsConfig()
+	assert.Nil(t, err)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+	assert.Nil(t, tlsConfig.RootCAs)
+	assert.Empty(t, tlsConfig.Certificates)
+
+	// registered into driver and referenced by DSN
+	entry.Bootstrap(context.TODO())
+	defer entry.Interrupt(context.TODO())
+	assert.Equal(t, "rk-ut-tls-mode", entry.tlsConfigName)
+	assert.Equal(t, []string{"tls=rk-ut-tls-mode"}, entry.withTlsParam(nil))
+
+	// verify-ca could not work without CA
+	assert.PanicsWithError(t, "tlsMode verify-ca of MySqlEntry ut-verify-ca requires certEntry with CA", func() {
+		RegisterMySqlEntry(WithName("ut-verify-ca"), WithTlsMode(TlsModeVerifyCA))
+	})
+}
+
+func TestMySqlEntry_BootstrapWithoutCA(t *testing.T) {
+	entry := RegisterMySqlEntry(
+		WithName("ut-tls"),
+		WithCertEntry(&rkentry.CertEntry{}),
+		WithTlsMode(TlsModeVerifyCA))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.PanicsWithError(t, "tlsMode verify-ca requires CA in certEntry ", func() {
+		entry.Bootstrap(context.TODO())
+	})
+}
+
+// Create certificate signed by parent, self-signed if parent is nil
+func newCert(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "ut-cert"},
+		DNSNames:              []string{"ut-host"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	return cert, key
+}
+
+func TestRegisterMySqlEntry_Replicas(t *testing.T) {
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    database:
+      - name: ut-database
+        replicas:
+          addrs: ["127.0.0.1:1", "127.0.0.1:2"]
+          policy: roundrobin
+      - name: ut-default
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-entry"].(*MySqlEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	innerDb := entry.getInnerDb("ut-database")
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2"}, innerDb.replicaAddrs)
+	assert.Equal(t, "roundrobin", innerDb.replicaPolicy)
+	assert.Empty(t, entry.getInnerDb("ut-default").replicaAddrs)
+
+	// nothing listening on replicas
+	sqlDb, err := sql.Open("mysql", "root:pass@tcp(127.0.0.1:1)/ut-database")
+	assert.Nil(t, err)
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDb, SkipInitializeWithVersion: true}),
+		&gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err)
+
+	replicas, err := entry.connectReplicas(context.TODO(), innerDb, db, &gorm.Config{}, "")
+	assert.NotNil(t, err)
+	assert.Nil(t, replicas)
+
+	// invalid policy
+	assert.Panics(t, func() {
+		RegisterMySqlEntry(
+			WithName("ut-invalid-policy"),
+			WithDatabase("ut-database", true, false),
+			WithReplicas("ut-database", "first", "127.0.0.1:1"))
+	})
+}
+
+func TestRoundRobinPolicy_Resolve(t *testing.T) {
+	pools := []gorm.ConnPool{&sql.DB{}, &sql.DB{}}
+	policy := &roundRobinPolicy{}
+
+	assert.Same(t, pools[0], policy.Resolve(pools))
+	assert.Same(t, pools[1], policy.Resolve(pools))
+	assert.Same(t, pools[0], policy.Resolve(pools))
+}
+
+func TestMySqlEntry_OpenWithRetry(t *testing.T) {
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    retry:
+      maxAttempts: 3
+      intervalMs: 10
+      maxIntervalMs: 15
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-entry"].(*MySqlEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.Equal(t, 3, entry.retryMaxAttempts)
+	assert.Equal(t, 10*time.Millisecond, entry.retryInterval)
+	assert.Equal(t, 15*time.Millisecond, entry.retryMaxInterval)
+
+	core, logs := observer.New(zap.WarnLevel)
+	entry.logger = &Logger{delegate: zap.New(core)}
+
+	// nothing listening on port 1
+	db, err := entry.openWithRetry(context.TODO(), mysql.Open("root:pass@tcp(127.0.0.1:1)/"), &gorm.Config{})
+	assert.NotNil(t, err)
+	assert.Nil(t, db)
+	assert.Equal(t, 2, logs.FilterMessageSnippet("retry in").Len())
+	assert.Equal(t, int64(2), logs.All()[1].ContextMap()["attempt"])
+
+	// fail fast by default
+	entry = RegisterMySqlEntry(WithName("ut-fail-fast"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.logger = &Logger{delegate: zap.New(core)}
+	_, err = entry.openWithRetry(context.TODO(), mysql.Open("root:pass@tcp(127.0.0.1:1)/"), &gorm.Config{})
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, logs.FilterMessageSnippet("retry in").Len())
+}
+
+func TestIsTransientError(t *testing.T) {
+	assert.True(t, isTransientError(errors.New("dial tcp 127.0.0.1:3306: connect: connection refused")))
+	assert.True(t, isTransientError(driver.ErrInvalidConn))
+	assert.True(t, isTransientError(&driver.MySQLError{Number: 1040}))
+	assert.False(t, isTransientError(&driver.MySQLError{Number: 1045}))
+}
+
+func TestMySqlEntry_ValidateAddr(t *testing.T) {
+	// default addr of unix socket
+	entry := RegisterMySqlEntry(WithName("ut-unix"), WithProtocol(ProtocolUnix))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	assert.Equal(t, DefaultUnixAddr, entry.Addr)
+
+	// invalid protocol
+	assert.PanicsWithError(t, "invalid protocol scoket of MySqlEntry ut-invalid, expect one of [tcp, unix]", func() {
+		RegisterMySqlEntry(WithName("ut-invalid"), WithProtocol("scoket"))
+	})
+
+	cases := []struct {
+		protocol string
+		addr     string
+		valid    bool
+	}{
+		{ProtocolTcp, "localhost:3306", true},
+		{ProtocolTcp, "[::1]:3306", true},
+		{ProtocolTcp, "localhost", false},
+		{ProtocolTcp, ":3306", false},
+		{ProtocolTcp, "localhost:mysql", false},
+		{ProtocolTcp, "localhost:65536", false},
+		{ProtocolUnix, "/var/run/mysqld/mysqld.sock", true},
+		{ProtocolUnix, "mysqld.sock", false},
+	}
+
+	for _, tc := range cases {
+		err := validateAddr(tc.protocol, tc.addr)
+		assert.Equal(t, tc.valid, err == nil, tc.addr)
+	}
+
+	// invalid replica addr
+	assert.Panics(t, func() {
+		RegisterMySqlEntry(
+			WithName("ut-invalid"),
+			WithDatabase("ut-database", true, false),
+			WithReplicas("ut-database", "", "replica"))
+	})
+}
+
+func TestMySqlEntry_ToDSN(t *testing.T) {
+	entry := RegisterMySqlEntry(WithName("ut-tcp"), WithUser("ut-user"), WithPass("ut-pass"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	dsn, redacted := entry.toDSN(entry.Addr, "ut-database", "charset=utf8mb4")
+	assert.Equal(t, "ut-user:ut-pass@tcp(localhost:3306)/ut-database?charset=utf8mb4", dsn)
+	assert.Equal(t, "ut-user:****@tcp(localhost:3306)/ut-database?charset=utf8mb4", redacted)
+
+	dsn, _ = entry.toDSN(entry.Addr, "", "charset=utf8mb4")
+	assert.Equal(t, "ut-user:ut-pass@tcp(localhost:3306)/?charset=utf8mb4", dsn)
+
+	cfg, err := driver.ParseDSN(dsn)
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp", cfg.Net)
+	assert.Equal(t, "localhost:3306", cfg.Addr)
+
+	entry = RegisterMySqlEntry(WithName("ut-unix"), WithUser("ut-user"), WithPass("ut-pass"),
+		WithProtocol(ProtocolUnix), WithAddr("/tmp/mysql.sock"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	dsn, redacted = entry.toDSN(entry.Addr, "ut-database", "charset=utf8mb4")
+	assert.Equal(t, "ut-user:ut-pass@unix(/tmp/mysql.sock)/ut-database?charset=utf8mb4", dsn)
+	assert.Equal(t, "ut-user:****@unix(/tmp/mysql.sock)/ut-database?charset=utf8mb4", redacted)
+
+	cfg, err = driver.ParseDSN(dsn)
+	assert.Nil(t, err)
+	assert.Equal(t, "unix", cfg.Net)
+	assert.Equal(t, "/tmp/mysql.sock", cfg.Addr)
+	assert.Equal(t, "ut-database", cfg.DBName)
+}
+
+func TestRegisterMySqlEntry_GormConfig(t *testing.T) {
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    database:
+      - name: ut-database
+        gorm:
+          prepareStmt: true
+          skipDefaultTransaction: true
+          createBatchSize: 100
+          tablePrefix: "t_"
+          singularTable: true
+          disableForeignKeyConstraintWhenMigrating: true
+          translateError: true
+      - name: ut-default
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-entry"].(*MySqlEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	config := entry.GormConfigMap["ut-database"]
+	assert.True(t, config.PrepareStmt)
+	assert.True(t, config.SkipDefaultTransaction)
+	assert.Equal(t, 100, config.CreateBatchSize)
+	assert.True(t, config.DisableForeignKeyConstraintWhenMigrating)
+	assert.True(t, config.TranslateError)
+	assert.Equal(t, schema.NamingStrategy{TablePrefix: "t_", SingularTable: true}, config.NamingStrategy)
+	// every database owns a copy of entry logger
+	assert.Equal(t, entry.logger, config.Logger)
+	assert.NotSame(t, entry.logger, config.Logger)
+
+	// same as before if nothing specified
+	assert.Equal(t, &gorm.Config{Logger: entry.logger}, entry.GormConfigMap["ut-default"])
+
+	// override
+	override := &gorm.Config{QueryFields: true}
+	entry = RegisterMySqlEntry(
+		WithName("ut-override"),
+		WithDatabase("ut-database", true, false),
+		WithGormOptions("ut-database", GormConfig{PrepareStmt: true}),
+		WithGormConfig("ut-database", override))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.Same(t, override, entry.GormConfigMap["ut-database"])
+	assert.False(t, override.PrepareStmt)
+	assert.Equal(t, entry.logger, override.Logger)
+	assert.True(t, override.DryRun)
+
+	// custom naming strategy survives bootstrap
+	mockDb, _, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer mockDb.Close()
+
+	naming := schema.NamingStrategy{TablePrefix: "custom_", NoLowerCase: true}
+	custom := &gorm.Config{NamingStrategy: naming, Logger: gormLogger.Discard}
+	entry = RegisterMySqlEntry(
+		WithName("ut-custom"),
+		WithDatabase("ut-database", false, false),
+		WithGormOptions("ut-database", GormConfig{TablePrefix: "t_"}),
+		WithGormConfig("ut-database", custom))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.getInnerDb("ut-database").dialector = mysql.New(mysql.Config{Conn: mockDb, SkipInitializeWithVersion: true})
+
+	entry.Bootstrap(context.TODO())
+	defer entry.Interrupt(context.TODO())
+
+	db := entry.GetDB("ut-database")
+	assert.NotNil(t, db)
+	assert.Same(t, custom, entry.GormConfigMap["ut-database"])
+	assert.Equal(t, naming, db.NamingStrategy)
+	assert.Equal(t, gormLogger.Discard, db.Logger)
+	assert.False(t, db.DryRun)
+}
+
+func TestRegisterMySqlEntry_DatabaseLogger(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	ignore := true
+
+	entry := RegisterMySqlEntry(
+		WithName("ut-logger"),
+		WithLogger(&Logger{
+			delegate:      zap.New(core),
+			LogLevel:      gormLogger.Warn,
+			SlowThreshold: 5 * time.Second,
+		}),
+		WithDatabase("ut-oltp", false, false),
+		WithDatabase("ut-batch", false, false),
+		WithDatabaseLogger("ut-oltp", DatabaseLogger{
+			Level:                     "info",
+			SlowThreshold:             100 * time.Millisecond,
+			IgnoreRecordNotFoundError: &ignore,
+		}),
+		WithDatabaseLogger("ut-batch", DatabaseLogger{Level: "silent"}))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	oltp := entry.GormConfigMap["ut-oltp"].Logger.(*Logger)
+	batch := entry.GormConfigMap["ut-batch"].Logger.(*Logger)
+	assert.NotSame(t, oltp, batch)
+
+	assert.Equal(t, gormLogger.Info, oltp.LogLevel)
+	assert.Equal(t, 100*time.Millisecond, oltp.SlowThreshold)
+	assert.True(t, oltp.IgnoreRecordNotFoundError)
+
+	// fields not provided inherit from entry
+	assert.Equal(t, gormLogger.Silent, batch.LogLevel)
+	assert.Equal(t, 5*time.Second, batch.SlowThreshold)
+	assert.False(t, batch.IgnoreRecordNotFoundError)
+
+	// entry logger untouched
+	assert.Equal(t, gormLogger.Warn, entry.logger.LogLevel)
+
+	oltp.Info(context.TODO(), "ut-oltp-message")
+	batch.Info(context.TODO(), "ut-batch-message")
+	batch.Error(context.TODO(), "ut-batch-error")
+	assert.Equal(t, 1, logs.FilterMessage("ut-oltp-message").Len())
+	assert.Equal(t, 0, logs.FilterMessage("ut-batch-message").Len())
+	assert.Equal(t, 0, logs.FilterMessage("ut-batch-error").Len())
+
+	// from YAML
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    logger:
+      level: warn
+    database:
+      - name: ut-oltp
+        logger:
+          level: info
+          slowThresholdMs: 100
+          ignoreRecordNotFoundError: true
+      - name: ut-batch
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	assert.NotEmpty(t, entries)
+	entry = entries["ut-entry"].(*MySqlEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	oltp = entry.GormConfigMap["ut-oltp"].Logger.(*Logger)
+	batch = entry.GormConfigMap["ut-batch"].Logger.(*Logger)
+	assert.Equal(t, gormLogger.Info, oltp.LogLevel)
+	assert.Equal(t, 100*time.Millisecond, oltp.SlowThreshold)
+	assert.True(t, oltp.IgnoreRecordNotFoundError)
+	assert.Equal(t, gormLogger.Warn, batch.LogLevel)
+	assert.Equal(t, 5*time.Second, batch.SlowThreshold)
+	assert.False(t, batch.IgnoreRecordNotFoundError)
+}
+
+func TestMySqlEntry_RedactPassword(t *testing.T) {
+	entry := RegisterMySqlEntry(
+		WithName("ut-redact"),
+		WithPass("ut-secret"),
+		WithAddr("127.0.0.1:1"),
+		WithDatabase("ut-database", false, true),
+		WithRetry(2, 10*time.Millisecond, 0))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	core, logs := observer.New(zap.DebugLevel)
+	entry.logger = &Logger{delegate: zap.New(core)}
+
+	err := entry.connect(context.TODO())
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "ut-secret")
+
+	assert.NotEmpty(t, logs.All())
+	for _, log := range logs.All() {
+		assert.NotContains(t, log.Message, "ut-secret")
+		for _, v := range log.ContextMap() {
+			assert.NotContains(t, fmt.Sprint(v), "ut-secret")
+		}
+	}
+
+	// error echoes DSN
+	dsn, _ := entry.toDSN(entry.Addr, "ut-database", "")
+	err = entry.redactError(fmt.Errorf("invalid DSN %s, %w", dsn, driver.ErrInvalidConn))
+	assert.Equal(t, "invalid DSN root:****@tcp(127.0.0.1:1)/ut-database?, invalid connection", err.Error())
+	assert.ErrorIs(t, err, driver.ErrInvalidConn)
+	assert.Nil(t, entry.redactError(nil))
+
+	// only password in DSN is masked, server message which contains password is kept
+	entry = RegisterMySqlEntry(WithName("ut-redact-default"), WithPass("YES"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	err = &driver.MySQLError{Number: 1045, Message: "Access denied for user 'root'@'localhost' (using password: YES)"}
+	assert.Same(t, err, entry.redactError(err))
+
+	err = fmt.Errorf("failed to connect to root:YES@tcp(localhost:3306)/ut, %w", err)
+	assert.Equal(t, "failed to connect to root:****@tcp(localhost:3306)/ut, "+
+		"Error 1045: Access denied for user 'root'@'localhost' (using password: YES)", entry.redactError(err).Error())
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("UT_MYSQL_PASS", "ut-pass")
+
+	// without variables
+	res, err := expandEnv("ut-pass")
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-pass", res)
+
+	// with variable
+	res, err = expandEnv("${UT_MYSQL_PASS}")
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-pass", res)
+
+	// with default value
+	res, err = expandEnv("${UT_MYSQL_USER:-root}")
+	assert.Nil(t, err)
+	assert.Equal(t, "root", res)
+
+	// with escaped $
+	res, err = expandEnv("pa$$${UT_MYSQL_PASS}$")
+	assert.Nil(t, err)
+	assert.Equal(t, "pa$ut-pass$", res)
+
+	// variable not set
+	_, err = expandEnv("${UT_MYSQL_NOT_EXIST}")
+	assert.NotNil(t, err)
+
+	// missing closing brace, input should not be echoed
+	_, err = expandEnv("ut-secret${UT_MYSQL_PASS")
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "ut-secret")
+}
+
+func TestReadPassFile(t *testing.T) {
+	dir := t.TempDir()
+
+	// trimmed
+	assert.Nil(t, os.WriteFile(path.Join(dir, "pass"), []byte("  ut-pass\n"), 0600))
+	pass, err := readPassFile(path.Join(dir, "pass"))
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-pass", pass)
+
+	// empty
+	assert.Nil(t, os.WriteFile(path.Join(dir, "empty"), []byte(" \n"), 0600))
+	_, err = readPassFile(path.Join(dir, "empty"))
+	assert.NotNil(t, err)
+
+	// missing
+	_, err = readPassFile(path.Join(dir, "not-exist"))
+	assert.NotNil(t, err)
+}
+
+func TestRegisterMySqlEntry_PassFile(t *testing.T) {
+	dir := t.TempDir()
+	passFile := path.Join(dir, "pass")
+	assert.Nil(t, os.WriteFile(passFile, []byte("ut-file-pass\n"), 0600))
+	t.Setenv("UT_MYSQL_USER", "ut-env-user")
+	t.Setenv("UT_MYSQL_PASS", "ut-env-pass")
+
+	bootConfigStr := fmt.Sprintf(`
+mysql:
+  - name: ut-pass
+    enabled: true
+    pass: ut-pass
+  - name: ut-pass-file
+    enabled: true
+    pass: ut-pass
+    passFile: %s
+  - name: ut-env
+    enabled: true
+    user: ${UT_MYSQL_USER}
+    pass: ${UT_MYSQL_PASS}
+    passFile: %s
+`, passFile, passFile)
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	assert.Len(t, entries, 3)
+
+	// pass < passFile < ${ENV}
+	entry := GetMySqlEntry("ut-pass")
+	assert.Equal(t, "ut-pass", entry.pass)
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	entry = GetMySqlEntry("ut-pass-file")
+	assert.Equal(t, "ut-file-pass", entry.pass)
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	entry = GetMySqlEntry("ut-env")
+	assert.Equal(t, "ut-env-user", entry.User)
+	assert.Equal(t, "ut-env-pass", entry.pass)
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// by option
+	entry = RegisterMySqlEntry(
+		WithName("ut-option"),
+		WithPass("ut-pass"),
+		WithPassFile(passFile))
+	assert.Equal(t, "ut-file-pass", entry.pass)
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// missing file
+	assert.Panics(t, func() {
+		RegisterMySqlEntry(WithName("ut-missing"), WithPassFile(path.Join(dir, "not-exist")))
+	})
+
+	// empty file
+	assert.Nil(t, os.WriteFile(passFile, []byte("\n"), 0600))
+	assert.Panics(t, func() {
+		RegisterMySqlEntry(WithName("ut-empty"), WithPassFile(passFile))
+	})
+
+	// variable not set
+	assert.Panics(t, func() {
+		RegisterMySqlEntryYAML([]byte(`
+mysql:
+  - name: ut-not-set
+    enabled: true
+    pass: ${UT_MYSQL_NOT_EXIST}
+`))
+	})
+}
+
+func TestRegisterMySqlEntry_Timeouts(t *testing.T) {
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    dialTimeoutMs: 3000
+    readTimeoutMs: 5000
+    database:
+      - name: ut-database
+        readTimeoutMs: 1000
+        writeTimeoutMs: 2000
+        params:
+          - "charset=utf8mb4"
+          - "readTimeout=30s"
+      - name: ut-default
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-entry"].(*MySqlEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.Equal(t, []string{"charset=utf8mb4", "timeout=3000ms", "readTimeout=1000ms", "writeTimeout=2000ms"},
+		entry.getInnerDb("ut-database").params)
+	assert.Equal(t, []string{"charset=utf8mb4", "parseTime=True", "loc=Local", "timeout=3000ms", "readTimeout=5000ms"},
+		entry.getInnerDb("ut-default").params)
+
+	// accepted by driver
+	dsn, _ := entry.toDSN(entry.Addr, "ut-database", strings.Join(entry.getInnerDb("ut-database").params, "&"))
+	cfg, err := driver.ParseDSN(dsn)
+	assert.Nil(t, err)
+	assert.Equal(t, 3*time.Second, cfg.Timeout)
+	assert.Equal(t, time.Second, cfg.ReadTimeout)
+	assert.Equal(t, 2*time.Second, cfg.WriteTimeout)
+
+	// negative
+	assert.PanicsWithError(t, "writeTimeout of database ut-database must not be negative", func() {
+		RegisterMySqlEntry(
+			WithName("ut-negative"),
+			WithDatabase("ut-database", true, false),
+			WithDatabaseTimeouts("ut-database", 0, 0, -time.Second))
+	})
+}
+
+func TestRegisterMySqlEntry_StatementParams(t *testing.T) {
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    database:
+      - name: ut-database
+        interpolateParams: true
+        params:
+          - "charset=utf8mb4"
+          - "interpolateParams=false"
+      - name: ut-default
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-entry"].(*MySqlEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.Equal(t, []string{"charset=utf8mb4", "interpolateParams=true"}, entry.getInnerDb("ut-database").params)
+	assert.Equal(t, []string{"charset=utf8mb4", "parseTime=True", "loc=Local"}, entry.getInnerDb("ut-default").params)
+
+	// multiStatements with warning
+	core, logs := observer.New(zap.WarnLevel)
+	entry = RegisterMySqlEntry(
+		WithName("ut-multi-statements"),
+		WithLogger(&Logger{delegate: zap.New(core)}),
+		WithDatabase("ut-database", true, false, "charset=utf8mb4"),
+		WithStatementParams("ut-database", true, true))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	dsn, _ := entry.toDSN(entry.Addr, "ut-database", strings.Join(entry.getInnerDb("ut-database").params, "&"))
+	assert.Equal(t, "root:pass@tcp(localhost:3306)/ut-database?charset=utf8mb4&interpolateParams=true&multiStatements=true", dsn)
+	cfg, err := driver.ParseDSN(dsn)
+	assert.Nil(t, err)
+	assert.True(t, cfg.InterpolateParams)
+	assert.True(t, cfg.MultiStatements)
+	assert.Equal(t, 1, logs.FilterMessageSnippet("multiStatements enabled for database [ut-database]").Len())
+
+	// raw multiStatements is warned as well
+	core, logs = observer.New(zap.WarnLevel)
+	entry = RegisterMySqlEntry(
+		WithName("ut-raw-multi-statements"),
+		WithLogger(&Logger{delegate: zap.New(core)}),
+		WithDatabase("ut-database", true, false, "multiStatements=true"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	assert.Equal(t, 1, logs.FilterMessageSnippet("multiStatements enabled for database [ut-database]").Len())
+
+	// rejected with prepareStmt
+	assert.PanicsWithError(t, "multiStatements of database ut-database could not be enabled with prepareStmt", func() {
+		RegisterMySqlEntry(
+			WithName("ut-prepare-stmt"),
+			WithDatabase("ut-database", true, false),
+			WithGormOptions("ut-database", GormConfig{PrepareStmt: true}),
+			WithStatementParams("ut-database", false, true))
+	})
+}
+
+func TestRegisterMySqlEntry_Dsn(t *testing.T) {
+	t.Setenv("UT_MYSQL_DSN_PASS", "ut-secret")
+
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    database:
+      - name: ut-database
+        dsn: "ut-user:${UT_MYSQL_DSN_PASS}@tcp(proxy:3306)/ut-app?tls=true"
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-entry"].(*MySqlEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	innerDb := entry.getInnerDb("ut-database")
+	assert.Equal(t, "ut-user:ut-secret@tcp(proxy:3306)/ut-app?tls=true", innerDb.dsn)
+	assert.NotContains(t, entry.String(), "ut-secret")
+
+	// password in raw dsn is redacted
+	assert.Equal(t, "ut-user:****@tcp(proxy:3306)/ut-app?tls=true", redactDsn(innerDb.dsn))
+	assert.Equal(t, "****", redactDsn("invalid"))
+	assert.Equal(t, "failed with ut-user:****@tcp(proxy:3306)/ut-app",
+		entry.redactError(errors.New("failed with ut-user:ut-secret@tcp(proxy:3306)/ut-app")).Error())
+
+	// warning of ignored fields
+	core, logs := observer.New(zap.WarnLevel)
+	entry = RegisterMySqlEntry(
+		WithName("ut-ignored"),
+		WithLogger(&Logger{delegate: zap.New(core)}),
+		WithAddr("localhost:3307"),
+		WithUser("ut-user"),
+		WithDatabase("ut-database", false, false, "charset=utf8mb4"),
+		WithDsn("ut-database", "ut-user:ut-secret@tcp(proxy:3306)/ut-app", ""))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	warns := logs.FilterMessage("Database [ut-database] is connected with raw dsn, ignoring [addr user params]").All()
+	assert.Len(t, warns, 1)
+	assert.Equal(t, "ut-user:****@tcp(proxy:3306)/ut-app", warns[0].ContextMap()["dsn"])
+	assert.Equal(t, []string{"charset=utf8mb4"}, entry.getInnerDb("ut-database").params)
+
+	// autoCreate requires adminDsn
+	assert.PanicsWithError(t, "autoCreate of database ut-database requires adminDsn if dsn provided", func() {
+		RegisterMySqlEntry(
+			WithName("ut-auto-create"),
+			WithDatabase("ut-database", false, true),
+			WithDsn("ut-database", "ut-user:ut-secret@tcp(proxy:3306)/ut-app", ""))
+	})
+
+	entry = RegisterMySqlEntry(
+		WithName("ut-admin-dsn"),
+		WithDatabase("ut-database", false, true),
+		WithDsn("ut-database", "ut-user:ut-secret@tcp(proxy:3306)/ut-app", "ut-admin:ut-admin-secret@tcp(proxy:3306)/"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	assert.Equal(t, "admin ut-admin:****@tcp(proxy:3306)/",
+		entry.redactError(errors.New("admin ut-admin:ut-admin-secret@tcp(proxy:3306)/")).Error())
+
+	// connect with raw dsn
+	core, logs = observer.New(zap.InfoLevel)
+	entry = RegisterMySqlEntry(
+		WithName("ut-connect-dsn"),
+		WithLogger(&Logger{delegate: zap.New(core)}),
+		WithLazy(),
+		WithDatabase("ut-database", false, false),
+		WithDsn("ut-database", "ut-user:ut-secret@tcp(127.0.0.1:1)/ut-app?timeout=100ms", ""))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	assert.NotNil(t, entry.Connect(context.TODO()))
+	connecting := logs.FilterMessage("Connecting to database [ut-database] with raw dsn").All()
+	assert.Len(t, connecting, 1)
+	assert.Equal(t, "ut-user:****@tcp(127.0.0.1:1)/ut-app?timeout=100ms", connecting[0].ContextMap()["dsn"])
+
+	// invalid dsn
+	assert.Panics(t, func() {
+		RegisterMySqlEntry(
+			WithName("ut-invalid-dsn"),
+			WithDatabase("ut-database", false, false),
+			WithDsn("ut-database", "ut-user:ut-secret@tcp(proxy:3306)", ""))
+	})
+}
+
+func TestMySqlEntry_Addrs(t *testing.T) {
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    lazy: true
+    addrs:
+      - "127.0.0.1:1"
+      - "127.0.0.1:2"
+    database:
+      - name: ut-database
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-entry"].(*MySqlEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2"}, entry.Addrs)
+	assert.Equal(t, "127.0.0.1:1", entry.Addr)
+	assert.NotNil(t, entry.nodeChanges)
+	assert.Nil(t, entry.RegisterPromMetrics(prometheus.NewRegistry()))
+
+	// nodes are tried in order
+	core, logs := observer.New(zap.InfoLevel)
+	entry.logger = &Logger{delegate: zap.New(core)}
+	assert.NotNil(t, entry.Connect(context.TODO()))
+	connecting := logs.FilterMessage("Connecting to database [ut-database]").All()
+	assert.Len(t, connecting, 2)
+	assert.Contains(t, connecting[0].ContextMap()["dsn"], "tcp(127.0.0.1:1)")
+	assert.Contains(t, connecting[1].ContextMap()["dsn"], "tcp(127.0.0.1:2)")
+	assert.Equal(t, 1, logs.FilterMessage("Failed to connect to node [127.0.0.1:1], trying next node").Len())
+	assert.Equal(t, "127.0.0.1:1", entry.activeAddr())
+
+	// active node changed
+	entry.setActiveAddr("127.0.0.1:2")
+	entry.setActiveAddr("127.0.0.1:2")
+	assert.Equal(t, "127.0.0.1:2", entry.activeAddr())
+	assert.Equal(t, 1, logs.FilterMessage("Active node of MySqlEntry changed").Len())
+	assert.Equal(t, float64(1), testutil.ToFloat64(entry.nodeChanges.WithLabelValues("127.0.0.1:1", "127.0.0.1:2")))
+
+	// switching fails if all nodes are unreachable
+	entry.checkNodes()
+	assert.Equal(t, 1, logs.FilterMessage("Failed to switch node of MySqlEntry").Len())
+	assert.Equal(t, "127.0.0.1:2", entry.activeAddr())
+
+	// invalid addr
+	assert.Panics(t, func() {
+		RegisterMySqlEntry(WithName("ut-invalid-addrs"), WithAddrs("127.0.0.1:3306", "localhost"))
+	})
+
+	// single node
+	single := RegisterMySqlEntry(WithName("ut-single-addr"), WithAddrs("127.0.0.1:3306"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(single)
+	assert.Nil(t, single.nodeChanges)
+}
+
+func TestRegisterMySqlEntry_CompatParams(t *testing.T) {
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    database:
+      - name: ut-database
+        allowNativePasswords: false
+        allowCleartextPasswords: true
+        params:
+          - "charset=utf8mb4"
+          - "allowNativePasswords=true"
+      - name: ut-default
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-entry"].(*MySqlEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.Equal(t, []string{"allowNativePasswords=false", "allowCleartextPasswords=true", "charset=utf8mb4"},
+		entry.getInnerDb("ut-database").params)
+	assert.Equal(t, []string{"charset=utf8mb4", "parseTime=True", "loc=Local"}, entry.getInnerDb("ut-default").params)
+
+	// accepted by driver
+	dsn, _ := entry.toDSN(entry.Addr, "ut-database", strings.Join(entry.getInnerDb("ut-database").params, "&"))
+	assert.Equal(t, "root:pass@tcp(localhost:3306)/ut-database?allowNativePasswords=false&allowCleartextPasswords=true&charset=utf8mb4", dsn)
+	cfg, err := driver.ParseDSN(dsn)
+	assert.Nil(t, err)
+	assert.False(t, cfg.AllowNativePasswords)
+	assert.True(t, cfg.AllowCleartextPasswords)
+
+	// warning of cleartext passwords with and without TLS
+	allow := true
+	core, logs := observer.New(zap.WarnLevel)
+	entry = RegisterMySqlEntry(
+		WithName("ut-cleartext"),
+		WithLogger(&Logger{delegate: zap.New(core)}),
+		WithDatabase("ut-plain", true, false),
+		WithDatabase("ut-tls", true, false, "tls=skip-verify"),
+		WithCompatParams("ut-plain", CompatParams{AllowCleartextPasswords: &allow}),
+		WithCompatParams("ut-tls", CompatParams{AllowCleartextPasswords: &allow}))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	assert.Equal(t, 1, logs.FilterMessageSnippet("allowCleartextPasswords enabled for database [ut-plain] without TLS").Len())
+	assert.Equal(t, 1, logs.FilterMessageSnippet("allowCleartextPasswords enabled for database [ut-tls], password will be sent in cleartext over TLS").Len())
+
+	// compress is not supported by driver
+	assert.Panics(t, func() {
+		RegisterMySqlEntry(
+			WithName("ut-compress"),
+			WithDatabase("ut-database", true, false),
+			WithCompatParams("ut-database", CompatParams{Compress: &allow}))
+	})
+}
+
+func TestMySqlEntry_Validate(t *testing.T) {
+	// valid
+	assert.Nil(t, newMySqlEntry(WithDatabase("ut-database", true, false)).Validate())
+
+	// aggregated errors
+	err := newMySqlEntry(
+		WithName("ut-invalid"),
+		WithAddr("localhost"),
+		WithDatabase("ut-database", true, false),
+		WithDatabase("ut-database", true, false),
+		WithMaxOpenConn("ut-database", -1),
+		WithRetry(-1, 0, 0)).Validate()
+	assert.NotNil(t, err)
+	assert.Equal(t, "invalid MySqlEntry ut-invalid, "+
+		"invalid addr of MySqlEntry ut-invalid, localhost is not in form of host:port, address localhost: missing port in address; "+
+		"retry.maxAttempts of MySqlEntry ut-invalid must not be negative; "+
+		"maxOpenConn of database ut-database must not be negative; "+
+		"duplicate database ut-database in MySqlEntry ut-invalid", err.Error())
+
+	// single error is returned as it is
+	assert.EqualError(t, newMySqlEntry(WithName("ut-invalid"), WithTlsMode("none")).Validate(),
+		"invalid tlsMode none of MySqlEntry ut-invalid, expect one of [required, verify-ca, skip-verify]")
+
+	// invalid rewrite of prom plugin provided programmatically
+	prom := plugins.NewProm(&plugins.PromConfig{
+		Table: plugins.TableLabelConfig{Rewrites: []plugins.TableRewrite{{Pattern: `(`}}},
+	})
+	err = newMySqlEntry(WithDatabase("ut-database", true, false), WithPlugin("ut-database", prom)).Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid table rewrite of prom plugin of database ut-database")
+
+	// YAML registration skips broken entry
+	bootConfigStr := `
+mysql:
+  - name: ut-valid
+    enabled: true
+    database:
+      - name: ut-database
+  - name: ut-broken
+    enabled: true
+    addr: "localhost:mysql"
+    database:
+      - name: ut-database
+        maxIdleConn: -1
+`
+
+	core, logs := observer.New(zap.ErrorLevel)
+	loggerEntry := rkentry.GlobalAppCtx.GetLoggerEntryDefault()
+	prev := loggerEntry.Logger
+	loggerEntry.Logger = zap.New(core)
+	defer func() {
+		loggerEntry.Logger = prev
+	}()
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	assert.Len(t, entries, 1)
+	assert.NotNil(t, entries["ut-valid"])
+	defer rkentry.GlobalAppCtx.RemoveEntry(entries["ut-valid"])
+	assert.Nil(t, GetMySqlEntry("ut-broken"))
+
+	skipped := logs.FilterMessage("Skip invalid MySqlEntry").All()
+	assert.Len(t, skipped, 1)
+	assert.Equal(t, "ut-broken", skipped[0].ContextMap()["entryName"])
+	assert.Contains(t, skipped[0].ContextMap()["error"], "maxIdleConn of database ut-database must not be negative")
+}
+
+func TestRegisterMySqlEntry_TimeZone(t *testing.T) {
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    database:
+      - name: ut-utc
+        timeZone: UTC
+        storeUTC: true
+      - name: ut-shanghai
+        timeZone: Asia/Shanghai
+        params:
+          - "charset=utf8mb4"
+          - "loc=Local"
+      - name: ut-default
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-entry"].(*MySqlEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// loc=Local replaced, and NowFunc returns UTC
+	assert.Equal(t, []string{"charset=utf8mb4", "parseTime=True", "loc=UTC"}, entry.getInnerDb("ut-utc").params)
+	nowFunc := entry.GormConfigMap["ut-utc"].NowFunc
+	assert.NotNil(t, nowFunc)
+	assert.Equal(t, time.UTC, nowFunc().Location())
+
+	// escaped in DSN and accepted by driver
+	params := entry.getInnerDb("ut-shanghai").params
+	assert.Equal(t, []string{"charset=utf8mb4", "loc=Asia%2FShanghai"}, params)
+	assert.Nil(t, entry.GormConfigMap["ut-shanghai"].NowFunc)
+	dsn, _ := entry.toDSN(entry.Addr, "ut-shanghai", strings.Join(params, "&"))
+	cfg, err := driver.ParseDSN(dsn)
+	assert.Nil(t, err)
+	assert.Equal(t, "Asia/Shanghai", cfg.Loc.String())
+
+	// default kept for backward compatibility
+	assert.Equal(t, []string{"charset=utf8mb4", "parseTime=True", "loc=Local"}, entry.getInnerDb("ut-default").params)
+	assert.Nil(t, entry.GormConfigMap["ut-default"].NowFunc)
+
+	// storeUTC without timeZone, NowFunc of custom config is kept
+	custom := time.Now
+	entry = RegisterMySqlEntry(
+		WithName("ut-store-utc"),
+		WithDatabase("ut-generated", true, false),
+		WithDatabase("ut-custom", true, false),
+		WithTimeZone("ut-generated", "", true),
+		WithTimeZone("ut-custom", "", true),
+		WithGormConfig("ut-custom", &gorm.Config{NowFunc: custom}))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	assert.Equal(t, []string{"charset=utf8mb4", "parseTime=True", "loc=Local"}, entry.getInnerDb("ut-generated").params)
+	assert.Equal(t, time.UTC, entry.GormConfigMap["ut-generated"].NowFunc().Location())
+	assert.Equal(t, time.Local, entry.GormConfigMap["ut-custom"].NowFunc().Location())
+
+	// invalid time zone
+	assert.Panics(t, func() {
+		RegisterMySqlEntry(
+			WithName("ut-invalid-tz"),
+			WithDatabase("ut-database", true, false),
+			WithTimeZone("ut-database", "Mars/Olympus", false))
+	})
+}
+
+func TestMySqlEntry_GetDBList(t *testing.T) {
+	entry := RegisterMySqlEntry(
+		WithName("ut-entry"),
+		WithDatabase("ut-second", true, false),
+		WithDatabase("ut-first", true, false),
+		WithDatabase("ut-lazy", true, false))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	first, second := &gorm.DB{}, &gorm.DB{}
+	entry.GormDbMap["ut-first"] = first
+	entry.GormDbMap["ut-second"] = second
+
+	// config order, not connected databases skipped
+	list := entry.GetDBList()
+	assert.Len(t, list, 2)
+	assert.Equal(t, "ut-second", list[0].Name)
+	assert.Same(t, second, list[0].DB)
+	assert.Equal(t, "ut-first", list[1].Name)
+
+	// more than one database
+	assert.Nil(t, entry.GetDefaultDB())
+
+	// missing database
+	core, logs := observer.New(zap.WarnLevel)
+	entry.logger = &Logger{delegate: zap.New(core)}
+	assert.Nil(t, entry.GetDB("ut-typo"))
+	assert.Equal(t, 1, logs.Len())
+	assert.Equal(t, []interface{}{"ut-second", "ut-first", "ut-lazy"}, logs.All()[0].ContextMap()["available"])
+
+	// package level
+	assert.Same(t, first, GetGormDb("ut-entry", "ut-first"))
+	assert.Nil(t, GetGormDb("ut-missing", "ut-first"))
+
+	// single database
+	single := RegisterMySqlEntry(WithName("ut-single"), WithDatabase("ut-database", true, false))
+	defer rkentry.GlobalAppCtx.RemoveEntry(single)
+	single.GormDbMap["ut-database"] = first
+	assert.Same(t, first, single.GetDefaultDB())
+}
+
+func TestMySqlEntry_Lazy(t *testing.T) {
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    lazy: true
+    addr: "127.0.0.1:1"
+    database:
+      - name: ut-database
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-entry"].(*MySqlEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	assert.True(t, entry.lazy)
+
+	// not connected while bootstrap
+	entry.Bootstrap(context.TODO())
+	defer entry.Interrupt(context.TODO())
+	assert.False(t, entry.IsHealthy())
+
+	// concurrent callers get error of connecting
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := entry.GetDBE("ut-database")
+			errs <- err
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		assert.NotNil(t, <-errs)
+	}
+	assert.Nil(t, entry.GetDB("ut-database"))
+	assert.False(t, entry.IsHealthy())
+
+	// missing database
+	_, err := entry.GetDBE("ut-missing")
+	assert.NotNil(t, err)
+
+	// connected without databases
+	empty := RegisterMySqlEntry(WithName("ut-empty"), WithLazy())
+	defer rkentry.GlobalAppCtx.RemoveEntry(empty)
+	empty.Bootstrap(context.TODO())
+	defer empty.Interrupt(context.TODO())
+	assert.False(t, empty.IsHealthy())
+	assert.Nil(t, empty.Connect(context.TODO()))
+	assert.True(t, empty.IsHealthy())
+
+	// connectLock is skipped once connected
+	empty.connectLock.Lock()
+	done := make(chan error, 1)
+	go func() {
+		_, err := empty.GetDBE("ut-missing")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.EqualError(t, err, "database ut-missing not found in MySqlEntry ut-empty")
+	case <-time.After(time.Second):
+		assert.Fail(t, "GetDBE is blocked by connectLock")
+	}
+	empty.connectLock.Unlock()
+}
+
+func TestMySqlEntry_LazyInterrupted(t *testing.T) {
+	entry := RegisterMySqlEntry(
+		WithName("ut-lazy-interrupted"),
+		WithAddr("10.255.255.1:3306"),
+		WithLazy(),
+		WithDatabase("ut-database", false, false))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.Bootstrap(context.TODO())
+
+	// unknown database is reported without connecting
+	start := time.Now()
+	_, err := entry.GetDBE("ut-missing")
+	assert.EqualError(t, err, "database ut-missing not found in MySqlEntry ut-lazy-interrupted")
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	// nothing is connected once interrupted
+	entry.Interrupt(context.TODO())
+	start = time.Now()
+	_, err = entry.GetDBE("ut-database")
+	assert.ErrorIs(t, err, ErrInterrupted)
+	assert.ErrorIs(t, entry.Connect(context.TODO()), ErrInterrupted)
+	assert.Nil(t, entry.GetDB("ut-database"))
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	assert.Empty(t, entry.GormDbMap)
+}
+
+func TestMySqlEntry_BootstrapWithContext(t *testing.T) {
+	entry := RegisterMySqlEntry(
+		WithName("ut-bootstrap-ctx"),
+		WithAddr("10.255.255.1:3306"),
+		WithRetry(3, time.Second, 0),
+		WithDatabase("ut-database", false, true))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	defer entry.Interrupt(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	assert.PanicsWithError(t,
+		"failed to connect to database at root:****@tcp(10.255.255.1:3306), connecting to database aborted, context deadline exceeded",
+		func() {
+			entry.Bootstrap(ctx)
+		})
+	assert.Less(t, time.Since(start), time.Second)
+	assert.False(t, entry.IsHealthy())
+
+	// cancelled before connecting
+	ctx, cancel = context.WithCancel(context.TODO())
+	cancel()
+	assert.ErrorIs(t, entry.Connect(ctx), context.Canceled)
+}
+
 func TestMySqlEntry_Bootstrap(t *testing.T) {
 	defer assertPanic(t)
 
 	entry := RegisterMySqlEntry(
-		WithAddr("fake-addr"),
+		WithAddr("fake-addr:3306"),
 		WithDatabase("ut-database", false, true))
 	entry.Bootstrap(context.TODO())
 
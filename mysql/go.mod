@@ -3,13 +3,16 @@ module github.com/rookie-ninja/rk-db/mysql
 go 1.18
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.0
+	github.com/go-sql-driver/mysql v1.7.0
 	github.com/prometheus/client_golang v1.17.0
 	github.com/rookie-ninja/rk-entry/v2 v2.2.20
 	github.com/rookie-ninja/rk-logger v1.2.13
 	github.com/stretchr/testify v1.8.4
 	go.uber.org/zap v1.25.0
-	gorm.io/driver/mysql v1.4.3
-	gorm.io/gorm v1.24.0
+	gorm.io/driver/mysql v1.5.0
+	gorm.io/gorm v1.25.0
+	gorm.io/plugin/dbresolver v1.4.0
 )
 
 require (
@@ -17,7 +20,6 @@ require (
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
 	github.com/fsnotify/fsnotify v1.6.0 // indirect
-	github.com/go-sql-driver/mysql v1.6.0 // indirect
 	github.com/golang-jwt/jwt/v4 v4.5.0 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/google/uuid v1.4.0 // indirect
@@ -53,7 +53,7 @@ func (l *Logger) Info(ctx context.Context, msg string, data ...interface{}) {
 
 	msg = l.trimMessage(fmt.Sprintf(msg, data...))
 
-	if l.LogLevel >= gormLogger.Error {
+	if l.LogLevel >= gormLogger.Info {
 		logger.Info(msg)
 	}
 }
@@ -72,7 +72,7 @@ func (l *Logger) Warn(ctx context.Context, msg string, data ...interface{}) {
 
 	msg = l.trimMessage(fmt.Sprintf(msg, data...))
 
-	if l.LogLevel >= gormLogger.Error {
+	if l.LogLevel >= gormLogger.Warn {
 		logger.Warn(msg)
 	}
 }
@@ -0,0 +1,70 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+package rkmysql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	gormLogger "gorm.io/gorm/logger"
+	"testing"
+	"time"
+)
+
+func TestLogger_LogLevel(t *testing.T) {
+	cases := []struct {
+		level    gormLogger.LogLevel
+		expected []zapcore.Level
+	}{
+		{level: gormLogger.Silent, expected: []zapcore.Level{}},
+		{level: gormLogger.Error, expected: []zapcore.Level{zapcore.ErrorLevel}},
+		{level: gormLogger.Warn, expected: []zapcore.Level{zapcore.WarnLevel, zapcore.ErrorLevel}},
+		{level: gormLogger.Info, expected: []zapcore.Level{zapcore.InfoLevel, zapcore.WarnLevel, zapcore.ErrorLevel}},
+	}
+
+	for _, c := range cases {
+		core, logs := observer.New(zap.DebugLevel)
+		logger := &Logger{
+			delegate: zap.New(core),
+			LogLevel: c.level,
+		}
+
+		logger.Info(context.TODO(), "ut-%s", "info")
+		logger.Warn(context.TODO(), "ut-%s", "warn")
+		logger.Error(context.TODO(), "ut-%s", "error")
+
+		levels := make([]zapcore.Level, 0)
+		for _, log := range logs.All() {
+			levels = append(levels, log.Level)
+		}
+		assert.Equal(t, c.expected, levels)
+	}
+}
+
+func TestLogger_Trace(t *testing.T) {
+	fc := func() (string, int64) {
+		return "SELECT 1", 1
+	}
+
+	// info level logs every SQL
+	core, logs := observer.New(zap.DebugLevel)
+	logger := &Logger{
+		delegate: zap.New(core),
+		LogLevel: gormLogger.Info,
+	}
+	logger.Trace(context.TODO(), time.Now(), fc, nil)
+	assert.Equal(t, 1, logs.FilterLevelExact(zapcore.InfoLevel).Len())
+
+	// warn level skips normal SQL
+	core, logs = observer.New(zap.DebugLevel)
+	logger = &Logger{
+		delegate: zap.New(core),
+		LogLevel: gormLogger.Warn,
+	}
+	logger.Trace(context.TODO(), time.Now(), fc, nil)
+	assert.Zero(t, logs.Len())
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkmysql
+
+import (
+	"bufio"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// noTransactionDirective marks a migration file which should not run inside transaction
+const noTransactionDirective = "-- rk:no-transaction"
+
+// migrations is used to apply .sql files in dir, applied versions are recorded in table
+type migrations struct {
+	dir   string
+	table string
+}
+
+// migrationFile is a .sql file whose version is file name without extension
+type migrationFile struct {
+	version string
+	path    string
+}
+
+// Apply .sql files in migration directory in order, each file will be applied exactly once.
+//
+// Statements in file are split by semicolon, since multiStatements is not enabled in DSN by default.
+// Please note that DDL statements cause implicit commit in MySQL, so transaction only protects DML statements.
+func (entry *MySqlEntry) migrate(innerDb *databaseInner, db *gorm.DB) error {
+	files, err := listMigrationFiles(innerDb.migrations.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list migrations of database %s, %w", innerDb.name, err)
+	}
+
+	table := quoteIdentifier(innerDb.migrations.table)
+	createTable := fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version VARCHAR(255) NOT NULL PRIMARY KEY, applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)", table)
+	if res := db.Exec(createTable); res.Error != nil {
+		return fmt.Errorf("failed to create migration table %s, %w", innerDb.migrations.table, res.Error)
+	}
+
+	applied := make([]string, 0)
+	if res := db.Raw(fmt.Sprintf("SELECT version FROM %s", table)).Scan(&applied); res.Error != nil {
+		return fmt.Errorf("failed to list applied migrations, %w", res.Error)
+	}
+
+	appliedSet := make(map[string]bool)
+	for i := range applied {
+		appliedSet[applied[i]] = true
+	}
+
+	insert := fmt.Sprintf("INSERT INTO %s (version) VALUES (?)", table)
+	for _, file := range files {
+		if appliedSet[file.version] {
+			continue
+		}
+
+		content, err := os.ReadFile(file.path)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s, %w", file.path, err)
+		}
+
+		apply := func(tx *gorm.DB) error {
+			for _, statement := range splitStatements(string(content)) {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Exec(insert, file.version).Error
+		}
+
+		if isNoTransaction(string(content)) {
+			err = apply(db)
+		} else {
+			err = db.Transaction(apply)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %s to database %s, %w", file.path, innerDb.name, err)
+		}
+
+		entry.logger.delegate.Info(fmt.Sprintf("Applied migration [%s] to database [%s]", file.version, innerDb.name),
+			zap.String("file", file.path))
+	}
+
+	return nil
+}
+
+// List .sql files in dir ordered by file name
+func listMigrationFiles(dir string) ([]*migrationFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*migrationFile, 0)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+
+		res = append(res, &migrationFile{
+			version: strings.TrimSuffix(e.Name(), ".sql"),
+			path:    path.Join(dir, e.Name()),
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].version < res[j].version
+	})
+
+	return res, nil
+}
+
+// Check whether noTransactionDirective exists in leading comments
+func isNoTransaction(content string) bool {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 1 {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "--") {
+			return false
+		}
+
+		if line == noTransactionDirective {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Split content into statements by semicolon, semicolons in quotes and comments are ignored.
+// Comments are removed except executable comments like /*!40101 ... */, DELIMITER of mysql client is not supported.
+func splitStatements(content string) []string {
+	res := make([]string, 0)
+	current := strings.Builder{}
+
+	appendStatement := func() {
+		if statement := strings.TrimSpace(current.String()); len(statement) > 0 {
+			res = append(res, statement)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+
+		switch {
+		// quoted string or identifier, backslash escapes next char except in identifier
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(content) && content[j] != c; j++ {
+				if content[j] == '\\' && c != '`' {
+					j++
+				}
+			}
+			if j >= len(content) {
+				j = len(content) - 1
+			}
+			current.WriteString(content[i : j+1])
+			i = j
+		// line comment
+		case c == '#' || isDoubleDashComment(content[i:]):
+			j := strings.IndexByte(content[i:], '\n')
+			if j < 0 {
+				j = len(content) - i
+			}
+			i += j - 1
+		// block comment
+		case strings.HasPrefix(content[i:], "/*"):
+			j := strings.Index(content[i+2:], "*/")
+			end := len(content)
+			if j >= 0 {
+				end = i + 2 + j + 2
+			}
+			if strings.HasPrefix(content[i:], "/*!") {
+				current.WriteString(content[i:end])
+			} else {
+				current.WriteByte(' ')
+			}
+			i = end - 1
+		case c == ';':
+			appendStatement()
+		default:
+			current.WriteByte(c)
+		}
+	}
+
+	appendStatement()
+
+	return res
+}
+
+// MySQL requires whitespace or control character after -- of comment
+func isDoubleDashComment(in string) bool {
+	if !strings.HasPrefix(in, "--") {
+		return false
+	}
+
+	return len(in) == 2 || in[2] <= ' '
+}
+
+// Quote identifier with backticks, embedded backticks will be escaped
+func quoteIdentifier(in string) string {
+	return "`" + strings.ReplaceAll(in, "`", "``") + "`"
+}
+
+// seedOptions is used to load data into database created by autoCreate
+type seedOptions struct {
+	script string
+	sql    []string
+	fatal  bool
+}
+
+// Execute seed script and statements in one transaction.
+//
+// Statements are split by semicolon as migrations, and DDL statements cause implicit commit in MySQL.
+func (entry *MySqlEntry) seedDatabase(innerDb *databaseInner, db *gorm.DB) error {
+	statements := make([]string, 0)
+	if len(innerDb.seed.script) > 0 {
+		content, err := os.ReadFile(innerDb.seed.script)
+		if err != nil {
+			return fmt.Errorf("failed to read seed script %s, %w", innerDb.seed.script, err)
+		}
+		statements = append(statements, splitStatements(string(content))...)
+	}
+	for i := range innerDb.seed.sql {
+		statements = append(statements, splitStatements(innerDb.seed.sql[i])...)
+	}
+
+	var rows int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range statements {
+			res := tx.Exec(statements[i])
+			if res.Error != nil {
+				return res.Error
+			}
+			rows += res.RowsAffected
+		}
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to seed database %s, %w", innerDb.name, err)
+	}
+
+	entry.logger.delegate.Info(fmt.Sprintf("Seeded database [%s]", innerDb.name),
+		zap.Int("statements", len(statements)),
+		zap.Int64("rowsAffected", rows))
+
+	return nil
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+package rkmysql
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestListMigrationFiles(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(path.Join(dir, "002_add_index.sql"), []byte(""), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "001_init.sql"), []byte(""), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "README.md"), []byte(""), 0644))
+	assert.Nil(t, os.Mkdir(path.Join(dir, "003_dir.sql"), 0755))
+
+	files, err := listMigrationFiles(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 2)
+	assert.Equal(t, "001_init", files[0].version)
+	assert.Equal(t, path.Join(dir, "001_init.sql"), files[0].path)
+	assert.Equal(t, "002_add_index", files[1].version)
+
+	// missing directory
+	_, err = listMigrationFiles(path.Join(dir, "not-exist"))
+	assert.NotNil(t, err)
+}
+
+func TestIsNoTransaction(t *testing.T) {
+	assert.False(t, isNoTransaction("CREATE TABLE t (id INT);"))
+	assert.True(t, isNoTransaction("-- create table\n\n-- rk:no-transaction\nCREATE TABLE t (id INT);"))
+	assert.False(t, isNoTransaction("CREATE TABLE t (id INT);\n-- rk:no-transaction"))
+}
+
+func TestSplitStatements(t *testing.T) {
+	// empty
+	assert.Empty(t, splitStatements(""))
+	assert.Empty(t, splitStatements(" ;\n-- comment only\n# comment;\n/* block; */"))
+
+	// multiple statements without trailing semicolon
+	assert.Equal(t,
+		[]string{"CREATE TABLE t (id INT)", "INSERT INTO t VALUES (1)"},
+		splitStatements("CREATE TABLE t (id INT);\nINSERT INTO t VALUES (1)"))
+
+	// semicolons in quotes
+	assert.Equal(t,
+		[]string{`INSERT INTO t VALUES ('a;b', "c;d", 'e\';f')`, "SELECT `x;y` FROM t"},
+		splitStatements("INSERT INTO t VALUES ('a;b', \"c;d\", 'e\\';f');\nSELECT `x;y` FROM t;"))
+
+	// semicolons in comments
+	assert.Equal(t,
+		[]string{"SELECT 1", "SELECT  2"},
+		splitStatements("-- first; one\nSELECT 1; # second; one\nSELECT /* inline; */2;"))
+
+	// -- without whitespace is not comment
+	assert.Equal(t, []string{"SELECT 1--1"}, splitStatements("SELECT 1--1;"))
+
+	// executable comments are kept
+	assert.Equal(t,
+		[]string{"/*!40101 SET NAMES utf8mb4 */", "SELECT 1"},
+		splitStatements("/*!40101 SET NAMES utf8mb4 */;\nSELECT 1;"))
+}
+
+func TestRegisterMySqlEntry_Migrations(t *testing.T) {
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    database:
+      - name: ut-default
+        migrations:
+          dir: migrations
+      - name: ut-custom
+        migrations:
+          dir: /ut/migrations
+          table: ut_versions
+      - name: ut-none
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	assert.NotEmpty(t, entries)
+
+	entry := GetMySqlEntry("ut-entry")
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	wd, _ := os.Getwd()
+	assert.Equal(t, &migrations{dir: path.Join(wd, "migrations"), table: "schema_migrations"}, entry.innerDbList[0].migrations)
+	assert.Equal(t, &migrations{dir: "/ut/migrations", table: "ut_versions"}, entry.innerDbList[1].migrations)
+	assert.Nil(t, entry.innerDbList[2].migrations)
+
+	// by option
+	entry = RegisterMySqlEntry(
+		WithName("ut-option"),
+		WithDatabase("ut-database", false, false),
+		WithMigrations("ut-database", "/ut/migrations", ""),
+		WithMigrations("ut-missing", "/ut/migrations", ""))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.Equal(t, &migrations{dir: "/ut/migrations", table: "schema_migrations"}, entry.innerDbList[0].migrations)
+}
+
+func TestMySqlEntry_Migrate(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(path.Join(dir, "001_init.sql"),
+		[]byte("CREATE TABLE users (id INT);\nINSERT INTO users VALUES (1);"), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "002_add_index.sql"),
+		[]byte("-- rk:no-transaction\nCREATE INDEX idx_id ON users (id);"), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "003_seed.sql"),
+		[]byte("INSERT INTO users VALUES (2);\nINSERT INTO users VALUES (3);"), 0644))
+
+	sqlDb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.Nil(t, err)
+	defer sqlDb.Close()
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDb, SkipInitializeWithVersion: true}),
+		&gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err)
+
+	entry := RegisterMySqlEntry(
+		WithName("ut-migrate"),
+		WithDatabase("ut-database", false, false),
+		WithMigrations("ut-database", dir, "ut_versions"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	core, logs := observer.New(zap.InfoLevel)
+	entry.logger = &Logger{delegate: zap.New(core)}
+	innerDb := entry.getInnerDb("ut-database")
+
+	createTable := "CREATE TABLE IF NOT EXISTS `ut_versions` " +
+		"(version VARCHAR(255) NOT NULL PRIMARY KEY, applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)"
+	insert := "INSERT INTO `ut_versions` (version) VALUES (?)"
+
+	// 001_init is applied, statements are split, each file is applied in its own transaction
+	// unless no-transaction directive provided
+	mock.ExpectExec(createTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version FROM `ut_versions`").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("001_init"))
+	mock.ExpectExec("CREATE INDEX idx_id ON users (id)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insert).WithArgs("002_add_index").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO users VALUES (2)").WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("INSERT INTO users VALUES (3)").WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec(insert).WithArgs("003_seed").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, entry.migrate(innerDb, db))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Len(t, logs.FilterMessage("Applied migration [002_add_index] to database [ut-database]").All(), 1)
+	assert.Len(t, logs.FilterMessage("Applied migration [003_seed] to database [ut-database]").All(), 1)
+	assert.Empty(t, logs.FilterMessage("Applied migration [001_init] to database [ut-database]").All())
+
+	// failed migration is rolled back, version is not recorded and error names the file
+	mock.ExpectExec(createTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version FROM `ut_versions`").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("001_init").AddRow("002_add_index"))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO users VALUES (2)").WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("INSERT INTO users VALUES (3)").WillReturnError(errors.New("ut-error"))
+	mock.ExpectRollback()
+
+	err = entry.migrate(innerDb, db)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("failed to apply migration %s to database ut-database",
+		path.Join(dir, "003_seed.sql")))
+	assert.Contains(t, err.Error(), "ut-error")
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	// missing directory
+	innerDb.migrations.dir = path.Join(dir, "not-exist")
+	assert.NotNil(t, entry.migrate(innerDb, db))
+}
+
+func TestRegisterMySqlEntry_Seed(t *testing.T) {
+	bootConfigStr := `
+mysql:
+  - name: ut-entry
+    enabled: true
+    database:
+      - name: ut-script
+        autoCreate: true
+        seedScript: seed.sql
+      - name: ut-sql
+        autoCreate: true
+        seedSQL:
+          - INSERT INTO flags (name) VALUES ('ut')
+        seedOnError: warn
+      - name: ut-none
+        autoCreate: true
+`
+
+	entries := RegisterMySqlEntryYAML([]byte(bootConfigStr))
+	assert.NotEmpty(t, entries)
+
+	entry := GetMySqlEntry("ut-entry")
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	wd, _ := os.Getwd()
+	assert.Equal(t, &seedOptions{script: path.Join(wd, "seed.sql"), fatal: true}, entry.innerDbList[0].seed)
+	assert.Equal(t, &seedOptions{sql: []string{"INSERT INTO flags (name) VALUES ('ut')"}}, entry.innerDbList[1].seed)
+	assert.Nil(t, entry.innerDbList[2].seed)
+}
+
+func TestMySqlEntry_SeedDatabase(t *testing.T) {
+	dir := t.TempDir()
+	script := path.Join(dir, "seed.sql")
+	assert.Nil(t, os.WriteFile(script, []byte("-- lookup\nINSERT INTO flags (name) VALUES ('a');\nINSERT INTO flags (name) VALUES ('b');\n"), 0644))
+
+	sqlDb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.Nil(t, err)
+	defer sqlDb.Close()
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDb, SkipInitializeWithVersion: true}),
+		&gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err)
+
+	entry := RegisterMySqlEntry(
+		WithName("ut-seed"),
+		WithDatabase("ut-database", false, true),
+		WithSeed("ut-database", script, []string{"INSERT INTO flags (name) VALUES ('c')"}, true))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	core, logs := observer.New(zap.InfoLevel)
+	entry.logger = &Logger{delegate: zap.New(core)}
+	innerDb := entry.getInnerDb("ut-database")
+
+	// all statements in one transaction
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO flags (name) VALUES ('a')").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO flags (name) VALUES ('b')").WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("INSERT INTO flags (name) VALUES ('c')").WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, entry.seedDatabase(innerDb, db))
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	seeded := logs.FilterMessage("Seeded database [ut-database]").All()
+	assert.Len(t, seeded, 1)
+	assert.Equal(t, int64(3), seeded[0].ContextMap()["statements"])
+	assert.Equal(t, int64(3), seeded[0].ContextMap()["rowsAffected"])
+
+	// rollback if any of statements failed
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO flags (name) VALUES ('a')").WillReturnError(errors.New("ut-error"))
+	mock.ExpectRollback()
+
+	err = entry.seedDatabase(innerDb, db)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "ut-database")
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	// missing script
+	innerDb.seed.script = path.Join(dir, "not-exist.sql")
+	assert.NotNil(t, entry.seedDatabase(innerDb, db))
+}
@@ -2,18 +2,58 @@ package plugins
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
 	rkmidprom "github.com/rookie-ninja/rk-entry/v2/middleware/prom"
 	"gorm.io/gorm"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// tableOther is label value of tables exceeding MaxValues of TableLabelConfig
+const tableOther = "other"
+
+// errCodeOther is label value of errors which are not MySQL errors or not in errCodeWhitelist
+const errCodeOther = "other"
+
+// errCodeWhitelist keeps cardinality of errCode label bounded
+var errCodeWhitelist = map[uint16]bool{
+	1040: true, // too many connections
+	1045: true, // access denied
+	1048: true, // column cannot be null
+	1054: true, // unknown column
+	1062: true, // duplicate entry
+	1064: true, // syntax error
+	1146: true, // table doesn't exist
+	1205: true, // lock wait timeout exceeded
+	1213: true, // deadlock found
+	1406: true, // data too long
+	1451: true, // foreign key constraint fails while deleting or updating parent row
+	1452: true, // foreign key constraint fails while adding or updating child row
+}
+
+// Returns number of MySQL error if whitelisted, errCodeOther otherwise
+func toErrCode(err error) string {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && errCodeWhitelist[mysqlErr.Number] {
+		return strconv.Itoa(int(mysqlErr.Number))
+	}
+
+	return errCodeOther
+}
+
 func toPromName(in string) string {
 	in = strings.ReplaceAll(in, "-", "")
 	in = strings.ReplaceAll(in, ":", "")
 	return in
 }
 
+// NewProm creates prom plugin, Initialize fails if any rewrite has invalid pattern,
+// use TableLabelConfig.Validate to check them beforehand
 func NewProm(conf *PromConfig) *Prom {
 	res := &Prom{
 		MetricsSet: rkmidprom.NewMetricsSet("rk", toPromName(conf.DbType), nil),
@@ -23,11 +63,29 @@ func NewProm(conf *PromConfig) *Prom {
 			"table",
 			"action",
 		},
-		Conf: conf,
+		Conf:   conf,
+		tables: make(map[string]struct{}),
+	}
+
+	if conf.Table.Disabled {
+		res.LabelKeys = []string{
+			"database",
+			"addr",
+			"action",
+		}
+	}
+
+	for _, rewrite := range conf.Table.Rewrites {
+		pattern, err := regexp.Compile(rewrite.Pattern)
+		if err != nil {
+			res.err = fmt.Errorf("invalid table rewrite of prom plugin, %v", err)
+			break
+		}
+		res.rewrites = append(res.rewrites, &tableRewrite{pattern: pattern, replacement: rewrite.Replacement})
 	}
 
 	res.MetricsSet.RegisterCounter("rowsAffected", res.LabelKeys...)
-	res.MetricsSet.RegisterCounter("error", res.LabelKeys...)
+	res.MetricsSet.RegisterCounter("error", append(append(make([]string, 0), res.LabelKeys...), "errCode")...)
 	res.MetricsSet.RegisterSummary("elapsedNano", rkmidprom.SummaryObjectives, res.LabelKeys...)
 
 	return res
@@ -38,16 +96,56 @@ const (
 )
 
 type PromConfig struct {
-	Enabled bool   `yaml:"enabled" json:"enabled"`
-	DbAddr  string `yaml:"-" json:"-"`
-	DbName  string `yaml:"-" json:"-"`
-	DbType  string `yaml:"-" json:"-"`
+	Enabled bool             `yaml:"enabled" json:"enabled"`
+	Table   TableLabelConfig `yaml:"table" json:"table"`
+	DbAddr  string           `yaml:"-" json:"-"`
+	DbName  string           `yaml:"-" json:"-"`
+	DbType  string           `yaml:"-" json:"-"`
+}
+
+// TableLabelConfig controls cardinality of table label, db.Statement.Table is used as it is by default
+type TableLabelConfig struct {
+	// remove table label from metrics
+	Disabled bool `yaml:"disabled" json:"disabled"`
+	// distinct values of table label, tables exceed it are labeled as other, 0 means unlimited
+	MaxValues int `yaml:"maxValues" json:"maxValues"`
+	// applied in order before MaxValues, the first matched one wins
+	Rewrites []TableRewrite `yaml:"rewrites" json:"rewrites"`
+}
+
+// TableRewrite replaces table matching Pattern with Replacement, like orders_\d+ with orders_*
+type TableRewrite struct {
+	Pattern     string `yaml:"pattern" json:"pattern"`
+	Replacement string `yaml:"replacement" json:"replacement"`
+}
+
+// Validate patterns of rewrites
+func (c *TableLabelConfig) Validate() error {
+	for i := range c.Rewrites {
+		if _, err := regexp.Compile(c.Rewrites[i].Pattern); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 type Prom struct {
 	MetricsSet *rkmidprom.MetricsSet
 	LabelKeys  []string
 	Conf       *PromConfig
+
+	rewrites []*tableRewrite
+	// invalid rewrite found by NewProm, returned by Initialize
+	err error
+	// distinct values of table label seen, bounded by MaxValues
+	tables     map[string]struct{}
+	tablesLock sync.RWMutex
+}
+
+type tableRewrite struct {
+	pattern     *regexp.Regexp
+	replacement string
 }
 
 func (p *Prom) Name() string {
@@ -74,13 +172,22 @@ func (p *Prom) after(action string) func(db *gorm.DB) {
 
 		elapsed := time.Now().Sub(endTime).Nanoseconds()
 
+		// table label is skipped while disabled, so that values won't be recorded into distinct tables
 		labelValues := []string{
 			p.Conf.DbName,
 			p.Conf.DbAddr,
-			db.Statement.Table,
 			action,
 		}
 
+		if !p.Conf.Table.Disabled {
+			labelValues = []string{
+				p.Conf.DbName,
+				p.Conf.DbAddr,
+				p.toTableLabel(db.Statement.Table),
+				action,
+			}
+		}
+
 		if observer, err := p.MetricsSet.GetSummary("elapsedNano").GetMetricWithLabelValues(labelValues...); err == nil {
 			observer.Observe(float64(elapsed))
 		}
@@ -89,14 +196,55 @@ func (p *Prom) after(action string) func(db *gorm.DB) {
 			counter.Add(float64(db.Statement.RowsAffected))
 		}
 
-		if counter, err := p.MetricsSet.GetCounter("error").GetMetricWithLabelValues(labelValues...); err == nil && db.Statement.Error != nil {
-			counter.Inc()
+		if db.Statement.Error != nil {
+			errLabelValues := append(append(make([]string, 0), labelValues...), toErrCode(db.Statement.Error))
+			if counter, err := p.MetricsSet.GetCounter("error").GetMetricWithLabelValues(errLabelValues...); err == nil {
+				counter.Inc()
+			}
 		}
+	}
+}
 
+// Rewrite table and cap distinct values at MaxValues, safe for concurrent use
+func (p *Prom) toTableLabel(table string) string {
+	for _, rewrite := range p.rewrites {
+		if rewrite.pattern.MatchString(table) {
+			table = rewrite.pattern.ReplaceAllString(table, rewrite.replacement)
+			break
+		}
 	}
+
+	if p.Conf.Table.MaxValues < 1 {
+		return table
+	}
+
+	p.tablesLock.RLock()
+	_, ok := p.tables[table]
+	p.tablesLock.RUnlock()
+	if ok {
+		return table
+	}
+
+	p.tablesLock.Lock()
+	defer p.tablesLock.Unlock()
+
+	if _, ok := p.tables[table]; ok {
+		return table
+	}
+
+	if len(p.tables) >= p.Conf.Table.MaxValues {
+		return tableOther
+	}
+
+	p.tables[table] = struct{}{}
+	return table
 }
 
 func (p *Prom) Initialize(db *gorm.DB) error {
+	if p.err != nil {
+		return p.err
+	}
+
 	// query
 	if err := db.Callback().Query().Before("gorm:query").Register(":before_query", p.before()); err != nil {
 		return err
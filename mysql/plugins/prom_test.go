@@ -0,0 +1,161 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestToErrCode(t *testing.T) {
+	// whitelisted
+	assert.Equal(t, "1213", toErrCode(&mysql.MySQLError{Number: 1213}))
+	assert.Equal(t, "1062", toErrCode(fmt.Errorf("wrapped, %w", &mysql.MySQLError{Number: 1062})))
+
+	// not whitelisted
+	assert.Equal(t, "other", toErrCode(&mysql.MySQLError{Number: 1234}))
+
+	// not MySQL error
+	assert.Equal(t, "other", toErrCode(errors.New("ut-error")))
+	assert.Equal(t, "other", toErrCode(gorm.ErrRecordNotFound))
+	assert.Equal(t, "other", toErrCode(mysql.ErrInvalidConn))
+}
+
+func TestProm_ErrorCounter(t *testing.T) {
+	prom := NewProm(&PromConfig{
+		Enabled: true,
+		DbAddr:  "localhost:3306",
+		DbName:  "ut-database",
+		DbType:  "ut-mysql",
+	})
+	defer prom.MetricsSet.UnRegisterCounter("error")
+	defer prom.MetricsSet.UnRegisterCounter("rowsAffected")
+	defer prom.MetricsSet.UnRegisterSummary("elapsedNano")
+
+	after := prom.after("create")
+	for _, err := range []error{
+		&mysql.MySQLError{Number: 1213},
+		&mysql.MySQLError{Number: 1213},
+		&mysql.MySQLError{Number: 1062},
+		errors.New("ut-error"),
+		nil,
+	} {
+		db := &gorm.DB{Error: err}
+		db.Statement = &gorm.Statement{
+			DB:      db,
+			Context: context.WithValue(context.TODO(), startTimeKey, time.Now()),
+			Table:   "ut-table",
+		}
+		after(db)
+	}
+
+	counter := prom.MetricsSet.GetCounter("error")
+	assert.Equal(t, 3, testutil.CollectAndCount(counter))
+	assert.Equal(t, float64(2),
+		testutil.ToFloat64(counter.WithLabelValues("ut-database", "localhost:3306", "ut-table", "create", "1213")))
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(counter.WithLabelValues("ut-database", "localhost:3306", "ut-table", "create", "1062")))
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(counter.WithLabelValues("ut-database", "localhost:3306", "ut-table", "create", "other")))
+}
+
+func TestProm_TableLabel(t *testing.T) {
+	// default behavior
+	prom := &Prom{Conf: &PromConfig{}, tables: make(map[string]struct{})}
+	assert.Equal(t, "orders_1", prom.toTableLabel("orders_1"))
+
+	// rewrite
+	conf := &PromConfig{
+		Table: TableLabelConfig{
+			Rewrites: []TableRewrite{
+				{Pattern: `^orders_\d+$`, Replacement: "orders_*"},
+				{Pattern: `^orders_.*$`, Replacement: "unreachable"},
+			},
+		},
+	}
+	assert.Nil(t, conf.Table.Validate())
+	prom = NewProm(conf)
+	assert.Nil(t, prom.err)
+	assert.Len(t, prom.rewrites, 2)
+	assert.Equal(t, "orders_*", prom.toTableLabel("orders_1"))
+	assert.Equal(t, "orders_*", prom.toTableLabel("orders_20"))
+	assert.Equal(t, "users", prom.toTableLabel("users"))
+
+	// invalid pattern fails Initialize instead of being ignored
+	conf.Table.Rewrites = append(conf.Table.Rewrites, TableRewrite{Pattern: `(`, Replacement: "invalid"})
+	assert.NotNil(t, conf.Table.Validate())
+	err := NewProm(conf).Initialize(&gorm.DB{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid table rewrite of prom plugin")
+
+	// cap distinct values under concurrent access
+	prom = &Prom{Conf: &PromConfig{Table: TableLabelConfig{MaxValues: 10}}, tables: make(map[string]struct{})}
+	labels := sync.Map{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				table := fmt.Sprintf("tenant_%d", j)
+				labels.Store(prom.toTableLabel(table), true)
+			}
+		}()
+	}
+	wg.Wait()
+
+	distinct := 0
+	labels.Range(func(key, value interface{}) bool {
+		if key != tableOther {
+			distinct++
+		}
+		return true
+	})
+	assert.Equal(t, 10, distinct)
+	assert.Len(t, prom.tables, 10)
+
+	// known tables keep their values, and the rest are bucketed
+	for table := range prom.tables {
+		assert.Equal(t, table, prom.toTableLabel(table))
+	}
+	assert.Equal(t, tableOther, prom.toTableLabel("tenant_new"))
+}
+
+func TestProm_TableLabelDisabled(t *testing.T) {
+	prom := NewProm(&PromConfig{
+		Enabled: true,
+		Table:   TableLabelConfig{Disabled: true, MaxValues: 1},
+		DbAddr:  "localhost:3306",
+		DbName:  "ut-database",
+		DbType:  "ut-mysql-disabled",
+	})
+	defer prom.MetricsSet.UnRegisterCounter("error")
+	defer prom.MetricsSet.UnRegisterCounter("rowsAffected")
+	defer prom.MetricsSet.UnRegisterSummary("elapsedNano")
+
+	assert.Equal(t, []string{"database", "addr", "action"}, prom.LabelKeys)
+
+	after := prom.after("update")
+	for _, table := range []string{"orders_1", "orders_2"} {
+		db := &gorm.DB{RowsAffected: 1}
+		db.Statement = &gorm.Statement{
+			DB:      db,
+			Context: context.WithValue(context.TODO(), startTimeKey, time.Now()),
+			Table:   table,
+		}
+		after(db)
+	}
+
+	counter := prom.MetricsSet.GetCounter("rowsAffected")
+	assert.Equal(t, 1, testutil.CollectAndCount(counter))
+	assert.Equal(t, float64(2), testutil.ToFloat64(counter.WithLabelValues("ut-database", "localhost:3306", "update")))
+
+	// tables are not recorded while disabled
+	assert.Empty(t, prom.tables)
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkpostgres
+
+import (
+	"bufio"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// noTransactionDirective marks a migration file which could not run inside transaction,
+// for example, CREATE INDEX CONCURRENTLY
+const noTransactionDirective = "-- rk:no-transaction"
+
+// migrations is used to apply .sql files in dir, applied versions are recorded in table
+type migrations struct {
+	dir   string
+	table string
+}
+
+// migrationFile is a .sql file whose version is file name without extension
+type migrationFile struct {
+	version string
+	path    string
+}
+
+// Apply .sql files in migration directory in order, each file will be applied exactly once
+func (entry *PostgresEntry) migrate(innerDb *databaseInner, db *gorm.DB) error {
+	files, err := listMigrationFiles(innerDb.migrations.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list migrations of database %s, %w", innerDb.name, err)
+	}
+
+	table := quoteIdentifier(innerDb.migrations.table)
+	createTable := fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version VARCHAR(255) PRIMARY KEY, applied_at TIMESTAMPTZ NOT NULL DEFAULT now())", table)
+	if res := db.Exec(createTable); res.Error != nil {
+		return fmt.Errorf("failed to create migration table %s, %w", innerDb.migrations.table, res.Error)
+	}
+
+	applied := make([]string, 0)
+	if res := db.Raw(fmt.Sprintf("SELECT version FROM %s", table)).Scan(&applied); res.Error != nil {
+		return fmt.Errorf("failed to list applied migrations, %w", res.Error)
+	}
+
+	appliedSet := make(map[string]bool)
+	for i := range applied {
+		appliedSet[applied[i]] = true
+	}
+
+	insert := fmt.Sprintf("INSERT INTO %s (version) VALUES (?)", table)
+	for _, file := range files {
+		if appliedSet[file.version] {
+			continue
+		}
+
+		content, err := os.ReadFile(file.path)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s, %w", file.path, err)
+		}
+
+		if isNoTransaction(string(content)) {
+			err = db.Exec(string(content)).Error
+			if err == nil {
+				err = db.Exec(insert, file.version).Error
+			}
+		} else {
+			err = db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(string(content)).Error; err != nil {
+					return err
+				}
+				return tx.Exec(insert, file.version).Error
+			})
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %s to database %s, %w", file.path, innerDb.name, err)
+		}
+
+		entry.logger.delegate.Info(fmt.Sprintf("Applied migration [%s] to database [%s]", file.version, innerDb.name),
+			zap.String("file", file.path))
+	}
+
+	return nil
+}
+
+// List .sql files in dir ordered by file name
+func listMigrationFiles(dir string) ([]*migrationFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*migrationFile, 0)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+
+		res = append(res, &migrationFile{
+			version: strings.TrimSuffix(e.Name(), ".sql"),
+			path:    path.Join(dir, e.Name()),
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].version < res[j].version
+	})
+
+	return res, nil
+}
+
+// Check whether noTransactionDirective exists in leading comments
+func isNoTransaction(content string) bool {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 1 {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "--") {
+			return false
+		}
+
+		if line == noTransactionDirective {
+			return true
+		}
+	}
+
+	return false
+}
+
+// seedOptions is used to load data into database created by autoCreate
+type seedOptions struct {
+	script string
+	sql    []string
+	fatal  bool
+}
+
+// Execute seed script and statements in one transaction
+func (entry *PostgresEntry) seedDatabase(innerDb *databaseInner, db *gorm.DB) error {
+	statements := make([]string, 0)
+	if len(innerDb.seed.script) > 0 {
+		content, err := os.ReadFile(innerDb.seed.script)
+		if err != nil {
+			return fmt.Errorf("failed to read seed script %s, %w", innerDb.seed.script, err)
+		}
+		statements = append(statements, string(content))
+	}
+	statements = append(statements, innerDb.seed.sql...)
+
+	var rows int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range statements {
+			res := tx.Exec(statements[i])
+			if res.Error != nil {
+				return res.Error
+			}
+			rows += res.RowsAffected
+		}
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to seed database %s, %w", innerDb.name, err)
+	}
+
+	entry.logger.delegate.Info(fmt.Sprintf("Seeded database [%s]", innerDb.name),
+		zap.Int("statements", len(statements)),
+		zap.Int64("rowsAffected", rows))
+
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+package rkpostgres
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestListMigrationFiles(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(path.Join(dir, "002_add_index.sql"), []byte(""), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "001_init.sql"), []byte(""), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "README.md"), []byte(""), 0644))
+	assert.Nil(t, os.Mkdir(path.Join(dir, "003_dir.sql"), 0755))
+
+	files, err := listMigrationFiles(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 2)
+	assert.Equal(t, "001_init", files[0].version)
+	assert.Equal(t, path.Join(dir, "001_init.sql"), files[0].path)
+	assert.Equal(t, "002_add_index", files[1].version)
+
+	// missing directory
+	_, err = listMigrationFiles(path.Join(dir, "not-exist"))
+	assert.NotNil(t, err)
+}
+
+func TestIsNoTransaction(t *testing.T) {
+	assert.False(t, isNoTransaction("CREATE TABLE t (id INT);"))
+	assert.True(t, isNoTransaction("-- add index\n\n-- rk:no-transaction\nCREATE INDEX CONCURRENTLY i ON t (id);"))
+	assert.False(t, isNoTransaction("CREATE INDEX i ON t (id);\n-- rk:no-transaction"))
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	assert.Equal(t, `"schema_migrations"`, quoteIdentifier("schema_migrations"))
+	assert.Equal(t, `"ut""table"`, quoteIdentifier(`ut"table`))
+}
+
+func TestRegisterPostgresEntry_Migrations(t *testing.T) {
+	bootConfigStr := `
+postgres:
+  - name: ut-entry
+    enabled: true
+    database:
+      - name: ut-default
+        migrations:
+          dir: migrations
+      - name: ut-custom
+        migrations:
+          dir: /ut/migrations
+          table: ut_versions
+      - name: ut-none
+`
+
+	entries := RegisterPostgresEntryYAML([]byte(bootConfigStr))
+	assert.NotEmpty(t, entries)
+
+	entry := GetPostgresEntry("ut-entry")
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	wd, _ := os.Getwd()
+	assert.Equal(t, &migrations{dir: path.Join(wd, "migrations"), table: "schema_migrations"}, entry.innerDbList[0].migrations)
+	assert.Equal(t, &migrations{dir: "/ut/migrations", table: "ut_versions"}, entry.innerDbList[1].migrations)
+	assert.Nil(t, entry.innerDbList[2].migrations)
+}
+
+func TestPostgresEntry_Migrate(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(path.Join(dir, "001_init.sql"),
+		[]byte("CREATE TABLE users (id INT);\nINSERT INTO users VALUES (1);"), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "002_index.sql"),
+		[]byte("-- rk:no-transaction\nCREATE INDEX CONCURRENTLY idx_id ON users (id);"), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "003_broken.sql"),
+		[]byte("ALTER TABLE users ADD;"), 0644))
+
+	sqlDb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.Nil(t, err)
+	defer sqlDb.Close()
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDb}), &gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err)
+
+	bootConfigStr := fmt.Sprintf(`
+postgres:
+  - name: ut-entry
+    enabled: true
+    database:
+      - name: ut-database
+        migrations:
+          dir: %s
+          table: ut_versions
+`, dir)
+
+	entries := RegisterPostgresEntryYAML([]byte(bootConfigStr))
+	assert.NotEmpty(t, entries)
+
+	entry := GetPostgresEntry("ut-entry")
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	core, logs := observer.New(zap.InfoLevel)
+	entry.logger.delegate = zap.New(core)
+	innerDb := entry.innerDbList[0]
+
+	createTable := `CREATE TABLE IF NOT EXISTS "ut_versions" ` +
+		`(version VARCHAR(255) PRIMARY KEY, applied_at TIMESTAMPTZ NOT NULL DEFAULT now())`
+	insert := `INSERT INTO "ut_versions" (version) VALUES ($1)`
+
+	// 001 is applied already, 002 runs without transaction and 003 fails
+	mock.ExpectExec(createTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version FROM "ut_versions"`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("001_init"))
+	mock.ExpectExec("-- rk:no-transaction\nCREATE INDEX CONCURRENTLY idx_id ON users (id);").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insert).WithArgs("002_index").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("ALTER TABLE users ADD;").WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+
+	err = entry.migrate(innerDb, db)
+	assert.EqualError(t, err,
+		"failed to apply migration "+path.Join(dir, "003_broken.sql")+" to database ut-database, syntax error")
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Len(t, logs.FilterMessage("Applied migration [002_index] to database [ut-database]").All(), 1)
+	assert.Empty(t, logs.FilterMessage("Applied migration [003_broken] to database [ut-database]").All())
+
+	// file is executed with version recorded in one transaction
+	assert.Nil(t, os.Remove(path.Join(dir, "003_broken.sql")))
+	mock.ExpectExec(createTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version FROM "ut_versions"`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("002_index"))
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE users (id INT);\nINSERT INTO users VALUES (1);").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insert).WithArgs("001_init").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, entry.migrate(innerDb, db))
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	// all applied
+	mock.ExpectExec(createTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version FROM "ut_versions"`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("001_init").AddRow("002_index"))
+
+	assert.Nil(t, entry.migrate(innerDb, db))
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	// missing directory
+	innerDb.migrations.dir = path.Join(dir, "not-exist")
+	assert.NotNil(t, entry.migrate(innerDb, db))
+}
+
+func TestRegisterPostgresEntry_Seed(t *testing.T) {
+	bootConfigStr := `
+postgres:
+  - name: ut-entry
+    enabled: true
+    database:
+      - name: ut-script
+        autoCreate: true
+        seedScript: seed.sql
+      - name: ut-sql
+        autoCreate: true
+        seedSQL:
+          - INSERT INTO flags (name) VALUES ('ut')
+        seedOnError: warn
+      - name: ut-none
+        autoCreate: true
+`
+
+	entries := RegisterPostgresEntryYAML([]byte(bootConfigStr))
+	assert.NotEmpty(t, entries)
+
+	entry := GetPostgresEntry("ut-entry")
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	wd, _ := os.Getwd()
+	assert.Equal(t, &seedOptions{script: path.Join(wd, "seed.sql"), fatal: true}, entry.innerDbList[0].seed)
+	assert.Equal(t, &seedOptions{sql: []string{"INSERT INTO flags (name) VALUES ('ut')"}}, entry.innerDbList[1].seed)
+	assert.Nil(t, entry.innerDbList[2].seed)
+}
@@ -2,6 +2,7 @@ package plugins
 
 import (
 	"context"
+	"database/sql"
 	rkmidprom "github.com/rookie-ninja/rk-entry/v2/middleware/prom"
 	"gorm.io/gorm"
 	"strings"
@@ -30,6 +31,12 @@ func NewProm(conf *PromConfig) *Prom {
 	res.MetricsSet.RegisterCounter("error", res.LabelKeys...)
 	res.MetricsSet.RegisterSummary("elapsedNano", rkmidprom.SummaryObjectives, res.LabelKeys...)
 
+	// transactions
+	res.MetricsSet.RegisterCounter("txBegun", txLabelKeys...)
+	res.MetricsSet.RegisterCounter("txCommitted", txLabelKeys...)
+	res.MetricsSet.RegisterCounter("txRolledBack", txLabelKeys...)
+	res.MetricsSet.RegisterSummary("txElapsedNano", rkmidprom.SummaryObjectives, txLabelKeys...)
+
 	return res
 }
 
@@ -37,6 +44,11 @@ const (
 	startTimeKey = "rk-startTime"
 )
 
+var txLabelKeys = []string{
+	"database",
+	"addr",
+}
+
 type PromConfig struct {
 	Enabled bool   `yaml:"enabled" json:"enabled"`
 	DbAddr  string `yaml:"-" json:"-"`
@@ -97,6 +109,12 @@ func (p *Prom) after(action string) func(db *gorm.DB) {
 }
 
 func (p *Prom) Initialize(db *gorm.DB) error {
+	// transactions are not covered by callbacks, so track them with ConnPool
+	if _, ok := db.ConnPool.(*txConnPool); !ok && db.ConnPool != nil {
+		db.ConnPool = &txConnPool{ConnPool: db.ConnPool, prom: p}
+		db.Statement.ConnPool = db.ConnPool
+	}
+
 	// query
 	if err := db.Callback().Query().Before("gorm:query").Register(":before_query", p.before()); err != nil {
 		return err
@@ -139,3 +157,106 @@ func (p *Prom) Initialize(db *gorm.DB) error {
 
 	return nil
 }
+
+// txConnPool records metrics of transactions begun with it,
+// nested transactions are savepoints in the same transaction which won't be counted
+type txConnPool struct {
+	gorm.ConnPool
+	prom *Prom
+}
+
+// GetDBConn returns sql.DB of wrapped ConnPool, used by gorm.DB.DB()
+func (c *txConnPool) GetDBConn() (*sql.DB, error) {
+	if connector, ok := c.ConnPool.(gorm.GetDBConnector); ok && connector != nil {
+		return connector.GetDBConn()
+	}
+
+	if db, ok := c.ConnPool.(*sql.DB); ok {
+		return db, nil
+	}
+
+	return nil, gorm.ErrInvalidDB
+}
+
+// BeginTx begins transaction with wrapped ConnPool
+func (c *txConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	var tx gorm.ConnPool
+	var err error
+
+	switch beginner := c.ConnPool.(type) {
+	case gorm.TxBeginner:
+		tx, err = beginner.BeginTx(ctx, opts)
+	case gorm.ConnPoolBeginner:
+		tx, err = beginner.BeginTx(ctx, opts)
+	default:
+		err = gorm.ErrInvalidTransaction
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.prom.incTx("txBegun")
+
+	return &txConn{ConnPool: tx, prom: c.prom, startTime: time.Now()}, nil
+}
+
+// txConn records result and duration of transaction
+type txConn struct {
+	gorm.ConnPool
+	prom      *Prom
+	startTime time.Time
+}
+
+// Commit transaction
+func (c *txConn) Commit() error {
+	committer, ok := c.ConnPool.(gorm.TxCommitter)
+	if !ok {
+		return gorm.ErrInvalidTransaction
+	}
+
+	err := committer.Commit()
+	if err == nil {
+		c.prom.incTx("txCommitted")
+	}
+	c.prom.observeTx(c.startTime)
+
+	return err
+}
+
+// Rollback transaction
+func (c *txConn) Rollback() error {
+	committer, ok := c.ConnPool.(gorm.TxCommitter)
+	if !ok {
+		return gorm.ErrInvalidTransaction
+	}
+
+	err := committer.Rollback()
+	if err == nil {
+		c.prom.incTx("txRolledBack")
+	}
+	c.prom.observeTx(c.startTime)
+
+	return err
+}
+
+// StmtContext is used by prepared statements in transaction
+func (c *txConn) StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt {
+	if tx, ok := c.ConnPool.(gorm.Tx); ok {
+		return tx.StmtContext(ctx, stmt)
+	}
+
+	return stmt
+}
+
+func (p *Prom) incTx(name string) {
+	if counter, err := p.MetricsSet.GetCounter(name).GetMetricWithLabelValues(p.Conf.DbName, p.Conf.DbAddr); err == nil {
+		counter.Inc()
+	}
+}
+
+func (p *Prom) observeTx(startTime time.Time) {
+	if observer, err := p.MetricsSet.GetSummary("txElapsedNano").GetMetricWithLabelValues(p.Conf.DbName, p.Conf.DbAddr); err == nil {
+		observer.Observe(float64(time.Since(startTime).Nanoseconds()))
+	}
+}
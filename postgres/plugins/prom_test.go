@@ -0,0 +1,56 @@
+package plugins
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"regexp"
+	"testing"
+)
+
+func TestProm_Transaction(t *testing.T) {
+	mockDb, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer mockDb.Close()
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: mockDb}), &gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err)
+
+	prom := NewProm(&PromConfig{DbName: "ut-database", DbAddr: "ut-addr", DbType: "postgresql"})
+	assert.Nil(t, db.Use(prom))
+
+	// sql.DB is still accessible
+	inner, err := db.DB()
+	assert.Nil(t, err)
+	assert.Equal(t, mockDb, inner)
+
+	// committed transaction with nested one which should not be counted
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SAVEPOINT")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return tx.Transaction(func(tx *gorm.DB) error {
+			return nil
+		})
+	})
+	assert.Nil(t, err)
+
+	// rolled back transaction
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return errors.New("ut-error")
+	})
+	assert.NotNil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	counter := func(name string) float64 {
+		return testutil.ToFloat64(prom.MetricsSet.GetCounterWithValues(name, "ut-database", "ut-addr"))
+	}
+	assert.Equal(t, float64(2), counter("txBegun"))
+	assert.Equal(t, float64(1), counter("txCommitted"))
+	assert.Equal(t, float64(1), counter("txRolledBack"))
+}
@@ -0,0 +1,160 @@
+package plugins
+
+import (
+	"context"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	spanKey            = "rk-span"
+	maxStatementLength = 1024
+)
+
+var noopTracerProvider = trace.NewNoopTracerProvider()
+
+func NewTrace(conf *TraceConfig) *Trace {
+	return &Trace{
+		Conf: conf,
+	}
+}
+
+// TraceConfig of trace plugin, SQL is recorded with placeholders unless RecordValues enabled,
+// since bound values may contain sensitive data
+type TraceConfig struct {
+	Enabled      bool   `yaml:"enabled" json:"enabled"`
+	RecordValues bool   `yaml:"recordValues" json:"recordValues"`
+	DbAddr       string `yaml:"-" json:"-"`
+	DbName       string `yaml:"-" json:"-"`
+	DbType       string `yaml:"-" json:"-"`
+}
+
+type Trace struct {
+	Conf *TraceConfig
+}
+
+func (t *Trace) Name() string {
+	return "rk-trace-plugin"
+}
+
+func (t *Trace) before(action string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil || !trace.SpanFromContext(ctx).IsRecording() {
+			return
+		}
+
+		ctx, span := t.getTracer(ctx).Start(ctx, action)
+		span.SetAttributes(
+			attribute.String("db.system", t.Conf.DbType),
+			attribute.String("db.name", t.Conf.DbName),
+			attribute.String("db.addr", t.Conf.DbAddr),
+			attribute.String("db.operation", action),
+		)
+
+		db.Statement.Context = context.WithValue(ctx, spanKey, span)
+	}
+}
+
+func (t *Trace) after() func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Statement.Context == nil {
+			return
+		}
+
+		span, ok := db.Statement.Context.Value(spanKey).(trace.Span)
+		if !ok {
+			return
+		}
+
+		span.SetAttributes(
+			attribute.String("db.sql.table", db.Statement.Table),
+			attribute.String("db.statement", t.statement(db)),
+			attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+		)
+
+		if db.Statement.Error != nil && db.Statement.Error != gorm.ErrRecordNotFound {
+			span.RecordError(db.Statement.Error)
+			span.SetStatus(codes.Error, db.Statement.Error.Error())
+		}
+
+		span.End()
+	}
+}
+
+// statement returns SQL with placeholders, or variables bound if recordValues enabled
+func (t *Trace) statement(db *gorm.DB) string {
+	res := db.Statement.SQL.String()
+	if t.Conf.RecordValues && db.Dialector != nil {
+		res = db.Dialector.Explain(res, db.Statement.Vars...)
+	}
+
+	if len(res) > maxStatementLength {
+		res = res[:maxStatementLength] + "..."
+	}
+
+	return res
+}
+
+func (t *Trace) getTracer(ctx context.Context) trace.Tracer {
+	if v := ctx.Value(rkmid.TracerKey); v != nil {
+		if res, ok := v.(trace.Tracer); ok {
+			return res
+		}
+	}
+
+	if v := ctx.Value(rkmid.TracerKey.String()); v != nil {
+		if res, ok := v.(trace.Tracer); ok {
+			return res
+		}
+	}
+
+	return noopTracerProvider.Tracer("trace-noop")
+}
+
+func (t *Trace) Initialize(db *gorm.DB) error {
+	// query
+	if err := db.Callback().Query().Before("gorm:query").Register(":trace_before_query", t.before("query")); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().After("gorm:query").Register(":trace_after_query", t.after()); err != nil {
+		return err
+	}
+
+	// create
+	if err := db.Callback().Create().Before("gorm:create").Register(":trace_before_create", t.before("create")); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().After("gorm:create").Register(":trace_after_create", t.after()); err != nil {
+		return err
+	}
+
+	// update
+	if err := db.Callback().Update().Before("gorm:update").Register(":trace_before_update", t.before("update")); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register(":trace_after_update", t.after()); err != nil {
+		return err
+	}
+
+	// delete
+	if err := db.Callback().Delete().Before("gorm:delete").Register(":trace_before_delete", t.before("delete")); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().After("gorm:delete").Register(":trace_after_delete", t.after()); err != nil {
+		return err
+	}
+
+	// raw
+	if err := db.Callback().Raw().Before("gorm:raw").Register(":trace_before_raw", t.before("raw")); err != nil {
+		return err
+	}
+	if err := db.Callback().Raw().After("gorm:raw").Register(":trace_after_raw", t.after()); err != nil {
+		return err
+	}
+
+	return nil
+}
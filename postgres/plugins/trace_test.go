@@ -0,0 +1,212 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	rkmid "github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// utSpan records attributes, status and errors, other methods are delegated to noop span
+type utSpan struct {
+	trace.Span
+	name   string
+	attrs  map[attribute.Key]attribute.Value
+	status codes.Code
+	desc   string
+	errs   []error
+	ended  bool
+}
+
+func newUtSpan(name string) *utSpan {
+	return &utSpan{
+		Span:  trace.SpanFromContext(context.Background()),
+		name:  name,
+		attrs: make(map[attribute.Key]attribute.Value),
+	}
+}
+
+func (s *utSpan) IsRecording() bool {
+	return !s.ended
+}
+
+func (s *utSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for i := range kv {
+		s.attrs[kv[i].Key] = kv[i].Value
+	}
+}
+
+func (s *utSpan) SetStatus(code codes.Code, description string) {
+	s.status = code
+	s.desc = description
+}
+
+func (s *utSpan) RecordError(err error, _ ...trace.EventOption) {
+	s.errs = append(s.errs, err)
+}
+
+func (s *utSpan) End(...trace.SpanEndOption) {
+	s.ended = true
+}
+
+// utTracer records started spans
+type utTracer struct {
+	spans []*utSpan
+}
+
+func (t *utTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := newUtSpan(name)
+	t.spans = append(t.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type utUser struct {
+	ID   int
+	Name string
+}
+
+func newTraceDB(t *testing.T, conf *TraceConfig) (*gorm.DB, sqlmock.Sqlmock) {
+	mockDb, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		mockDb.Close()
+	})
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: mockDb}), &gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err)
+	assert.Nil(t, db.Use(NewTrace(conf)))
+
+	return db, mock
+}
+
+// Returns context with recording parent span and tracer
+func newTraceContext(tracer trace.Tracer) (context.Context, *utSpan) {
+	parent := newUtSpan("parent")
+	ctx := trace.ContextWithSpan(context.Background(), parent)
+	return context.WithValue(ctx, rkmid.TracerKey, tracer), parent
+}
+
+func TestTrace_Span(t *testing.T) {
+	db, mock := newTraceDB(t, &TraceConfig{RecordValues: true, DbAddr: "ut-addr", DbName: "ut-database", DbType: "postgresql"})
+
+	tracer := &utTracer{}
+	ctx, parent := newTraceContext(tracer)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT name FROM users WHERE id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("ut-user"))
+
+	users := make([]utUser, 0)
+	assert.Nil(t, db.WithContext(ctx).Raw("SELECT name FROM users WHERE id = ?", 1).Find(&users).Error)
+	assert.Equal(t, []utUser{{Name: "ut-user"}}, users)
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	// child span is created and ended
+	assert.Len(t, tracer.spans, 1)
+	span := tracer.spans[0]
+	assert.Equal(t, "query", span.name)
+	assert.True(t, span.ended)
+	assert.False(t, parent.ended)
+	assert.Equal(t, codes.Unset, span.status)
+	assert.Empty(t, span.errs)
+
+	assert.Equal(t, "postgresql", span.attrs["db.system"].AsString())
+	assert.Equal(t, "ut-database", span.attrs["db.name"].AsString())
+	assert.Equal(t, "ut-addr", span.attrs["db.addr"].AsString())
+	assert.Equal(t, "query", span.attrs["db.operation"].AsString())
+	assert.Equal(t, "SELECT name FROM users WHERE id = 1", span.attrs["db.statement"].AsString())
+	assert.Equal(t, int64(1), span.attrs["db.rows_affected"].AsInt64())
+}
+
+func TestTrace_Error(t *testing.T) {
+	db, mock := newTraceDB(t, &TraceConfig{DbType: "postgresql"})
+
+	tracer := &utTracer{}
+	ctx, _ := newTraceContext(tracer)
+
+	// error of statement is recorded
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM users`)).WillReturnError(errors.New("ut-error"))
+	assert.NotNil(t, db.WithContext(ctx).Exec("DELETE FROM users").Error)
+
+	assert.Len(t, tracer.spans, 1)
+	span := tracer.spans[0]
+	assert.True(t, span.ended)
+	assert.Equal(t, codes.Error, span.status)
+	assert.Equal(t, "ut-error", span.desc)
+	assert.Len(t, span.errs, 1)
+
+	// record not found is not an error
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "ut_users"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	var user utUser
+	assert.ErrorIs(t, db.WithContext(ctx).First(&user).Error, gorm.ErrRecordNotFound)
+
+	assert.Len(t, tracer.spans, 2)
+	span = tracer.spans[1]
+	assert.Equal(t, "query", span.name)
+	assert.Equal(t, "ut_users", span.attrs["db.sql.table"].AsString())
+	assert.True(t, span.ended)
+	assert.Equal(t, codes.Unset, span.status)
+	assert.Empty(t, span.errs)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestTrace_Redact(t *testing.T) {
+	db, mock := newTraceDB(t, &TraceConfig{})
+
+	tracer := &utTracer{}
+	ctx, _ := newTraceContext(tracer)
+
+	// bound values are not recorded by default
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET name = $1`)).
+		WithArgs("ut-secret").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	assert.Nil(t, db.WithContext(ctx).Exec("UPDATE users SET name = ?", "ut-secret").Error)
+
+	span := tracer.spans[0]
+	assert.Equal(t, "UPDATE users SET name = $1", span.attrs["db.statement"].AsString())
+	assert.Equal(t, int64(2), span.attrs["db.rows_affected"].AsInt64())
+
+	// long statement is truncated
+	long := "SELECT '" + strings.Repeat("x", maxStatementLength) + "'"
+	mock.ExpectExec(regexp.QuoteMeta(long)).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.Nil(t, db.WithContext(ctx).Exec(long).Error)
+
+	statement := tracer.spans[1].attrs["db.statement"].AsString()
+	assert.Equal(t, long[:maxStatementLength]+"...", statement)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestTrace_WithoutParentSpan(t *testing.T) {
+	db, mock := newTraceDB(t, &TraceConfig{})
+
+	// no span created without recording parent span
+	tracer := &utTracer{}
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM users`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.Nil(t, db.WithContext(context.WithValue(context.Background(), rkmid.TracerKey, tracer)).
+		Exec("DELETE FROM users").Error)
+	assert.Empty(t, tracer.spans)
+
+	// tracer is looked up with string key too
+	ctx := context.WithValue(trace.ContextWithSpan(context.Background(), newUtSpan("parent")),
+		rkmid.TracerKey.String(), tracer)
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM users`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.Nil(t, db.WithContext(ctx).Exec("DELETE FROM users").Error)
+	assert.Len(t, tracer.spans, 1)
+
+	// noop tracer is used if tracer is missing
+	parent := newUtSpan("parent")
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM users`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.Nil(t, db.WithContext(trace.ContextWithSpan(context.Background(), parent)).Exec("DELETE FROM users").Error)
+	assert.Len(t, tracer.spans, 1)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
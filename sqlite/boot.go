@@ -8,9 +8,12 @@ package rksqlite
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/mattn/go-sqlite3"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rookie-ninja/rk-db/sqlite/plugins"
 	"github.com/rookie-ninja/rk-entry/v2/entry"
@@ -19,9 +22,15 @@ import (
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	gormLogger "gorm.io/gorm/logger"
+	"io/fs"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -33,6 +42,12 @@ func init() {
 
 const SqliteEntryType = "SqliteEntry"
 
+// timestamp in file name of scheduled backup
+const backupTimeLayout = "20060102T150405.000Z"
+
+// ErrReadOnly is returned by writes against read-only database
+var ErrReadOnly = errors.New("database is read-only")
+
 // BootSqlite
 // SqliteEntry entry boot config which reflects to YAML config
 type BootSqlite struct {
@@ -50,10 +65,40 @@ type BootSqliteE struct {
 		InMemory bool     `yaml:"inMemory" json:"inMemory"`
 		Params   []string `yaml:"params" json:"params"`
 		DryRun   bool     `yaml:"dryRun" json:"dryRun"`
+		ReadOnly bool     `yaml:"readOnly" json:"readOnly"`
 		Plugins  struct {
 			Prom plugins.PromConfig `yaml:"prom"`
 		} `yaml:"plugins" json:"plugins"`
+		// PRAGMA applied to every connection, driver defaults will be kept if missing
+		JournalMode   string `yaml:"journalMode" json:"journalMode"`
+		BusyTimeoutMs int    `yaml:"busyTimeoutMs" json:"busyTimeoutMs"`
+		ForeignKeys   *bool  `yaml:"foreignKeys" json:"foreignKeys"`
+		Synchronous   string `yaml:"synchronous" json:"synchronous"`
+		// 0 keeps default which is 1 for file-backed database, negative means unlimited
+		MaxOpenConn       int `yaml:"maxOpenConn" json:"maxOpenConn"`
+		MaxIdleConn       int `yaml:"maxIdleConn" json:"maxIdleConn"`
+		ConnMaxLifetimeMs int `yaml:"connMaxLifetimeMs" json:"connMaxLifetimeMs"`
+		// SQLCipher key, precedence: encryptionKey < encryptionKeyFile < ${ENV} reference in encryptionKey
+		EncryptionKey     string `yaml:"encryptionKey" json:"-"`
+		EncryptionKeyFile string `yaml:"encryptionKeyFile" json:"encryptionKeyFile"`
+		// .sql files in dir will be applied in order of file name
+		Migrations struct {
+			Dir   string `yaml:"dir" json:"dir"`
+			Table string `yaml:"table" json:"table"`
+		} `yaml:"migrations" json:"migrations"`
+		// backup database periodically with VACUUM INTO
+		Backup struct {
+			Enabled    bool   `yaml:"enabled" json:"enabled"`
+			IntervalMs int    `yaml:"intervalMs" json:"intervalMs"`
+			Dir        string `yaml:"dir" json:"dir"`
+			Retention  int    `yaml:"retention" json:"retention"`
+		} `yaml:"backup" json:"backup"`
 	} `yaml:"database" json:"database"`
+	HealthCheck struct {
+		Enabled    bool `yaml:"enabled" json:"enabled"`
+		IntervalMs int  `yaml:"intervalMs" json:"intervalMs"`
+		CheckFile  bool `yaml:"checkFile" json:"checkFile"`
+	} `yaml:"healthCheck" json:"healthCheck"`
 	Logger struct {
 		Entry                     string   `json:"entry" yaml:"entry"`
 		Level                     string   `json:"level" yaml:"level"`
@@ -73,6 +118,17 @@ type SqliteEntry struct {
 	innerDbList      []*databaseInner        `yaml:"-" json:"-"`
 	GormDbMap        map[string]*gorm.DB     `yaml:"-" json:"-"`
 	GormConfigMap    map[string]*gorm.Config `yaml:"-" json:"-"`
+	// stops scheduled backups and health check, closed by Interrupt
+	quitChannel   chan struct{}
+	backgroundWg  sync.WaitGroup
+	interruptOnce sync.Once
+	// background health check, causes of unhealthy databases are recorded by name
+	healthCheckEnabled   bool
+	healthCheckInterval  time.Duration
+	healthCheckFile      bool
+	healthLock           sync.RWMutex
+	healthChecked        bool
+	unhealthyDatabaseMap map[string]error
 }
 
 type databaseInner struct {
@@ -80,8 +136,38 @@ type databaseInner struct {
 	dbDir    string
 	inMemory bool
 	dryRun   bool
+	readOnly bool
 	params   []string
 	plugins  []gorm.Plugin
+	pragma   Pragma
+	// applied after connected, skipped in dry run mode
+	migrations *migrations
+	// pool settings, maxOpenConn is 1 for file-backed database by default
+	maxOpenConn     int
+	maxIdleConn     int
+	connMaxLifetime time.Duration
+	// SQLCipher key which is never logged, contents of encryptionKeyFile override encryptionKey
+	encryptionKey     string
+	encryptionKeyFile string
+	// scheduled backup is disabled if interval is zero, backups exceed retention are removed
+	backupInterval  time.Duration
+	backupDir       string
+	backupRetention int
+	// read-only database on read-only filesystem is opened with immutable=1
+	immutable bool
+}
+
+// Pragma is PRAGMA of SQLite which will be applied to every connection of database with DSN params,
+// driver defaults will be kept for empty fields.
+type Pragma struct {
+	// JournalMode could be one of DELETE, TRUNCATE, PERSIST, MEMORY, WAL and OFF
+	JournalMode string
+	// BusyTimeout is duration to wait for locks before SQLITE_BUSY returned
+	BusyTimeout time.Duration
+	// ForeignKeys enables foreign key constraints
+	ForeignKeys *bool
+	// Synchronous could be one of OFF, NORMAL, FULL and EXTRA
+	Synchronous string
 }
 
 // Option will be extended in the future.
@@ -142,6 +228,135 @@ func WithPlugin(name string, plugin gorm.Plugin) Option {
 	}
 }
 
+// WithPragma provide PRAGMA of database, must be called after WithDatabase
+func WithPragma(name string, pragma Pragma) Option {
+	return func(entry *SqliteEntry) {
+		if inner := entry.getInnerDb(name); inner != nil {
+			inner.pragma = pragma
+		}
+	}
+}
+
+// WithMaxOpenConn provide max open connections of database, must be called after WithDatabase.
+// File-backed database is limited to 1 connection by default to prevent SQLITE_BUSY of concurrent writers,
+// negative value means unlimited.
+func WithMaxOpenConn(name string, maxOpenConn int) Option {
+	return func(entry *SqliteEntry) {
+		if inner := entry.getInnerDb(name); inner != nil {
+			inner.maxOpenConn = maxOpenConn
+		}
+	}
+}
+
+// WithMaxIdleConn provide max idle connections of database, must be called after WithDatabase
+func WithMaxIdleConn(name string, maxIdleConn int) Option {
+	return func(entry *SqliteEntry) {
+		if inner := entry.getInnerDb(name); inner != nil {
+			inner.maxIdleConn = maxIdleConn
+		}
+	}
+}
+
+// WithConnMaxLifetime provide max lifetime of connections of database, must be called after WithDatabase
+func WithConnMaxLifetime(name string, lifetime time.Duration) Option {
+	return func(entry *SqliteEntry) {
+		if inner := entry.getInnerDb(name); inner != nil {
+			inner.connMaxLifetime = lifetime
+		}
+	}
+}
+
+// WithEncryptionKey provide SQLCipher key of database, must be called after WithDatabase.
+// SQLite library linked by driver must be SQLCipher, the key is never logged.
+func WithEncryptionKey(name, key string) Option {
+	return func(entry *SqliteEntry) {
+		if inner := entry.getInnerDb(name); inner != nil {
+			inner.encryptionKey = key
+		}
+	}
+}
+
+// WithEncryptionKeyFile provide file which contains SQLCipher key of database, trimmed contents will override key
+// provided by WithEncryptionKey, must be called after WithDatabase. File is read while bootstrapping.
+func WithEncryptionKeyFile(name, path string) Option {
+	return func(entry *SqliteEntry) {
+		if inner := entry.getInnerDb(name); inner != nil && len(path) > 0 {
+			inner.encryptionKeyFile = toAbsPath(path)[0]
+		}
+	}
+}
+
+// WithReadOnly opens database with mode=ro, must be called after WithDatabase.
+// Database file must exist, and writes fail with ErrReadOnly.
+func WithReadOnly(name string) Option {
+	return func(entry *SqliteEntry) {
+		if inner := entry.getInnerDb(name); inner != nil {
+			inner.readOnly = true
+		}
+	}
+}
+
+// WithMigrations provide directory of .sql migrations of database, table defaults to schema_migrations,
+// should be called after WithDatabase()
+func WithMigrations(name, dir, table string) Option {
+	return func(entry *SqliteEntry) {
+		if inner := entry.getInnerDb(name); inner != nil && len(dir) > 0 {
+			if len(table) < 1 {
+				table = "schema_migrations"
+			}
+			inner.migrations = &migrations{
+				dir:   toAbsPath(dir)[0],
+				table: table,
+			}
+		}
+	}
+}
+
+// WithMigrationsFS provide .sql migrations in dir of fsys, for example, embed.FS, instead of directory on disk.
+// Dir defaults to root of fsys, table defaults to schema_migrations, should be called after WithDatabase()
+func WithMigrationsFS(name string, fsys fs.FS, dir, table string) Option {
+	return func(entry *SqliteEntry) {
+		if inner := entry.getInnerDb(name); inner != nil && fsys != nil {
+			if len(dir) < 1 {
+				dir = "."
+			}
+			if len(table) < 1 {
+				table = "schema_migrations"
+			}
+			inner.migrations = &migrations{
+				dir:   dir,
+				fsys:  fsys,
+				table: table,
+			}
+		}
+	}
+}
+
+// WithBackup enables scheduled backup of database, must be called after WithDatabase.
+// Backups are written into dir which is backup folder in dbDir if empty, oldest backups are removed
+// if count of backups exceeds retention, zero retention keeps all backups.
+func WithBackup(name string, interval time.Duration, dir string, retention int) Option {
+	return func(entry *SqliteEntry) {
+		if inner := entry.getInnerDb(name); inner != nil {
+			inner.backupInterval = interval
+			inner.backupDir = dir
+			inner.backupRetention = retention
+		}
+	}
+}
+
+// WithHealthCheck enables background health check which runs SELECT 1 against databases periodically,
+// existence of db files will be checked as well if checkFile is true.
+func WithHealthCheck(interval time.Duration, checkFile bool) Option {
+	return func(entry *SqliteEntry) {
+		entry.healthCheckEnabled = true
+		entry.healthCheckFile = checkFile
+		if interval > 0 {
+			entry.healthCheckInterval = interval
+		}
+	}
+}
+
 // WithLogger provide Logger
 func WithLogger(logger *Logger) Option {
 	return func(m *SqliteEntry) {
@@ -187,6 +402,21 @@ func RegisterSqliteEntryYAML(raw []byte) map[string]rkentry.Entry {
 	}
 
 	for _, element := range configMap {
+		// precedence of encryption key: encryptionKey < encryptionKeyFile < ${ENV} reference in encryptionKey
+		keyFromEnv := make([]bool, len(element.Database))
+
+		// expand environment variables in encryption keys
+		for i := range element.Database {
+			keyFromEnv[i] = strings.Contains(element.Database[i].EncryptionKey, "${")
+			for _, field := range []*string{&element.Database[i].EncryptionKey, &element.Database[i].EncryptionKeyFile} {
+				expanded, err := expandEnv(*field)
+				if err != nil {
+					rkentry.ShutdownWithError(fmt.Errorf("failed to expand config of SqliteEntry %s, %v", element.Name, err))
+				}
+				*field = expanded
+			}
+		}
+
 		logger := &Logger{
 			LogLevel:                  gormLogger.Warn,
 			SlowThreshold:             5000 * time.Millisecond,
@@ -246,9 +476,45 @@ func RegisterSqliteEntryYAML(raw []byte) map[string]rkentry.Entry {
 			WithLogger(logger),
 		}
 
+		if element.HealthCheck.Enabled {
+			opts = append(opts, WithHealthCheck(
+				time.Duration(element.HealthCheck.IntervalMs)*time.Millisecond, element.HealthCheck.CheckFile))
+		}
+
 		// iterate database section
-		for _, db := range element.Database {
-			opts = append(opts, WithDatabase(db.Name, db.DbDir, db.DryRun, db.InMemory, db.Params...))
+		for i, db := range element.Database {
+			opts = append(opts,
+				WithDatabase(db.Name, db.DbDir, db.DryRun, db.InMemory, db.Params...),
+				WithPragma(db.Name, Pragma{
+					JournalMode: db.JournalMode,
+					BusyTimeout: time.Duration(db.BusyTimeoutMs) * time.Millisecond,
+					ForeignKeys: db.ForeignKeys,
+					Synchronous: db.Synchronous,
+				}),
+				WithMaxOpenConn(db.Name, db.MaxOpenConn),
+				WithMaxIdleConn(db.Name, db.MaxIdleConn),
+				WithConnMaxLifetime(db.Name, time.Duration(db.ConnMaxLifetimeMs)*time.Millisecond),
+				WithEncryptionKey(db.Name, db.EncryptionKey))
+
+			if len(db.EncryptionKeyFile) > 0 && !keyFromEnv[i] {
+				opts = append(opts, WithEncryptionKeyFile(db.Name, db.EncryptionKeyFile))
+			}
+
+			if db.ReadOnly {
+				opts = append(opts, WithReadOnly(db.Name))
+			}
+
+			if len(db.Migrations.Dir) > 0 {
+				opts = append(opts, WithMigrations(db.Name, db.Migrations.Dir, db.Migrations.Table))
+			}
+
+			if db.Backup.Enabled {
+				interval := time.Hour
+				if db.Backup.IntervalMs != 0 {
+					interval = time.Duration(db.Backup.IntervalMs) * time.Millisecond
+				}
+				opts = append(opts, WithBackup(db.Name, interval, db.Backup.Dir, db.Backup.Retention))
+			}
 
 			if db.Plugins.Prom.Enabled {
 				if db.InMemory {
@@ -280,6 +546,10 @@ func RegisterSqliteEntry(opts ...Option) *SqliteEntry {
 		innerDbList:      make([]*databaseInner, 0),
 		GormDbMap:        make(map[string]*gorm.DB),
 		GormConfigMap:    make(map[string]*gorm.Config),
+		quitChannel:      make(chan struct{}),
+
+		healthCheckInterval:  5000 * time.Millisecond,
+		unhealthyDatabaseMap: make(map[string]error),
 	}
 
 	entry.logger = &Logger{
@@ -293,6 +563,32 @@ func RegisterSqliteEntry(opts ...Option) *SqliteEntry {
 		opts[i](entry)
 	}
 
+	for _, innerDb := range entry.innerDbList {
+		if err := innerDb.pragma.validate(); err != nil {
+			rkentry.ShutdownWithError(fmt.Errorf("invalid pragma of database %s, %w", innerDb.name, err))
+		}
+
+		if innerDb.inMemory && innerDb.encrypted() {
+			rkentry.ShutdownWithError(fmt.Errorf("encryption key is not supported by in-memory database %s", innerDb.name))
+		}
+
+		if innerDb.readOnly && innerDb.inMemory {
+			rkentry.ShutdownWithError(fmt.Errorf("read-only is not supported by in-memory database %s", innerDb.name))
+		}
+
+		if innerDb.readOnly && innerDb.migrations != nil {
+			rkentry.ShutdownWithError(fmt.Errorf("migrations could not be applied to read-only database %s", innerDb.name))
+		}
+
+		if innerDb.readOnly && len(innerDb.pragma.JournalMode) > 0 {
+			rkentry.ShutdownWithError(fmt.Errorf("journalMode could not be changed by read-only database %s", innerDb.name))
+		}
+
+		if innerDb.backupInterval < 0 || innerDb.backupRetention < 0 {
+			rkentry.ShutdownWithError(fmt.Errorf("backup interval and retention of database %s must not be negative", innerDb.name))
+		}
+	}
+
 	// create default gorm configs for databases
 	for _, innerDb := range entry.innerDbList {
 		entry.GormConfigMap[innerDb.name] = &gorm.Config{
@@ -327,15 +623,36 @@ func (entry *SqliteEntry) Bootstrap(ctx context.Context) {
 	if err := entry.connect(); err != nil {
 		fields = append(fields, zap.Error(err))
 		entry.logger.delegate.Error("Failed to connect to database", fields...)
-		rkentry.ShutdownWithError(errors.New("failed to connect to database"))
+		rkentry.ShutdownWithError(fmt.Errorf("failed to connect to database, %w", err))
+	}
+
+	// enable scheduled backups
+	for _, innerDb := range entry.innerDbList {
+		if innerDb.backupInterval > 0 && !innerDb.dryRun {
+			entry.backgroundWg.Add(1)
+			go entry.runBackup(innerDb)
+		}
+	}
+
+	// enable health check, check once before returning, otherwise healthy is reported until first tick
+	if entry.healthCheckEnabled {
+		entry.checkHealth()
+		entry.backgroundWg.Add(1)
+		go entry.runHealthCheck()
 	}
 }
 
 // Interrupt SqliteEntry
 func (entry *SqliteEntry) Interrupt(ctx context.Context) {
-	for _, db := range entry.GormDbMap {
-		closeDB(db)
-	}
+	entry.interruptOnce.Do(func() {
+		// stop scheduled backups and health check before databases closed
+		close(entry.quitChannel)
+		entry.backgroundWg.Wait()
+
+		for _, db := range entry.GormDbMap {
+			closeDB(db)
+		}
+	})
 
 	// extract eventId if exists
 	fields := make([]zap.Field, 0)
@@ -378,8 +695,17 @@ func (entry *SqliteEntry) String() string {
 	return string(bytes)
 }
 
-// IsHealthy checks healthy status remote provider
+// IsHealthy checks healthy status remote provider, result of latest background check is returned
+// if health check enabled, otherwise databases are pinged.
+//
+// Unhealthy is reported before first check if health check enabled.
 func (entry *SqliteEntry) IsHealthy() bool {
+	if entry.healthCheckEnabled {
+		entry.healthLock.RLock()
+		defer entry.healthLock.RUnlock()
+		return entry.healthChecked && len(entry.unhealthyDatabaseMap) < 1
+	}
+
 	for _, gormDb := range entry.GormDbMap {
 		if db, err := gormDb.DB(); err != nil {
 			return false
@@ -438,51 +764,103 @@ func (entry *SqliteEntry) connect() error {
 	for _, innerDb := range entry.innerDbList {
 		var db *gorm.DB
 		var err error
-		var dbFile string
 
 		entry.logger.delegate.Info(fmt.Sprintf("Connecting to database [%s]", innerDb.name))
 
-		// 1: create directory if missing
-		if !filepath.IsAbs(filepath.ToSlash(innerDb.dbDir)) {
+		// 1: create directory if missing, in-memory database is not backed by file
+		if !innerDb.inMemory && !filepath.IsAbs(filepath.ToSlash(innerDb.dbDir)) {
 			wd, err := os.Getwd()
 			if err != nil {
 				return err
 			}
 
 			innerDb.dbDir = filepath.ToSlash(filepath.Join(wd, innerDb.dbDir))
-			err = os.MkdirAll(innerDb.dbDir, os.ModePerm)
-			if err != nil {
-				return err
+			if !innerDb.readOnly {
+				err = os.MkdirAll(innerDb.dbDir, os.ModePerm)
+				if err != nil {
+					return err
+				}
 			}
 		}
 
-		dbFile = filepath.ToSlash(filepath.Join(innerDb.dbDir, innerDb.name+".db"))
+		// read-only database is never created
+		if innerDb.readOnly {
+			if _, err := os.Stat(innerDb.dbFile()); err != nil {
+				return fmt.Errorf("failed to open read-only database %s, %v", innerDb.name, err)
+			}
+			innerDb.immutable = onReadOnlyFS(innerDb.dbFile())
+		}
 
 		// 2: create dsn
-		params := []string{fmt.Sprintf("file:%s?", dbFile)}
-		params = append(params, innerDb.params...)
-
-		// 3: is memory mode?
-		if innerDb.inMemory {
-			params = append(params, "mode=memory")
+		dsn, err := innerDb.dsn()
+		if err != nil {
+			return err
 		}
 
-		dsn := strings.Join(params, "&")
+		// 3: encrypted database is keyed by every new connection before PRAGMA applied
+		dialector := sqlite.Open(dsn)
+		if innerDb.encrypted() {
+			key, err := innerDb.readEncryptionKey()
+			if err != nil {
+				return err
+			}
+
+			dialector = &sqlite.Dialector{
+				DSN:  dsn,
+				Conn: sql.OpenDB(newCipherConnector(dsn, key, innerDb.pragma)),
+			}
+		}
 
-		db, err = gorm.Open(sqlite.Open(dsn), entry.GormConfigMap[innerDb.name])
+		db, err = gorm.Open(dialector, entry.GormConfigMap[innerDb.name])
 
 		// failed to connect to database
 		if err != nil {
+			if innerDb.encrypted() {
+				return fmt.Errorf("failed to open encrypted database %s, encryption key is wrong or database is not encrypted, %w",
+					innerDb.name, err)
+			}
+			return err
+		}
+
+		if err := entry.applyPool(innerDb, db); err != nil {
+			closeDB(db)
 			return err
 		}
 
+		if innerDb.readOnly {
+			if err := registerReadOnlyCallbacks(innerDb.name, db); err != nil {
+				closeDB(db)
+				return err
+			}
+		}
+
+		// nothing is executed in dry run mode
+		if !innerDb.dryRun {
+			if err := verifyEncryption(innerDb, db); err != nil {
+				closeDB(db)
+				return err
+			}
+
+			if err := entry.verifyPragma(innerDb, db); err != nil {
+				closeDB(db)
+				return err
+			}
+
+			if innerDb.migrations != nil {
+				if err := entry.migrate(innerDb, db); err != nil {
+					closeDB(db)
+					return err
+				}
+			}
+		}
+
 		for i := range innerDb.plugins {
 			plugin := innerDb.plugins[i]
 			if promPlugin, ok := plugin.(*plugins.Prom); ok {
 				if innerDb.inMemory {
 					promPlugin.Conf.DbAddr = "memory"
 				} else {
-					promPlugin.Conf.DbAddr = dbFile
+					promPlugin.Conf.DbAddr = innerDb.dbFile()
 				}
 			}
 			if err := db.Use(innerDb.plugins[i]); err != nil {
@@ -497,6 +875,595 @@ func (entry *SqliteEntry) connect() error {
 	return nil
 }
 
+// Returns inner database with name, nil will be returned if missing
+func (entry *SqliteEntry) getInnerDb(name string) *databaseInner {
+	for _, innerDb := range entry.innerDbList {
+		if innerDb.name == name {
+			return innerDb
+		}
+	}
+
+	return nil
+}
+
+// Backup database into destPath with VACUUM INTO, which is safe while writers are active.
+// Parent directories are created if missing, error will be returned if destPath exists.
+func (entry *SqliteEntry) Backup(ctx context.Context, dbName, destPath string) error {
+	return entry.backup(ctx, dbName, destPath, false)
+}
+
+// BackupOverwrite is the same as Backup except existing destPath will be replaced.
+func (entry *SqliteEntry) BackupOverwrite(ctx context.Context, dbName, destPath string) error {
+	return entry.backup(ctx, dbName, destPath, true)
+}
+
+func (entry *SqliteEntry) backup(ctx context.Context, dbName, destPath string, overwrite bool) error {
+	db := entry.GetDB(dbName)
+	if db == nil {
+		return fmt.Errorf("database %s not found", dbName)
+	}
+
+	if innerDb := entry.getInnerDb(dbName); innerDb != nil && innerDb.dryRun {
+		return fmt.Errorf("database %s is in dry run mode", dbName)
+	}
+
+	destPath, err := filepath.Abs(destPath)
+	if err != nil {
+		return err
+	}
+
+	if !overwrite {
+		if _, err := os.Stat(destPath); err == nil {
+			return fmt.Errorf("backup file %s already exists", destPath)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	// VACUUM INTO accepts empty file, backup is written into temp file first,
+	// so destPath is never left partially written
+	tmp, err := os.CreateTemp(filepath.Dir(destPath), filepath.Base(destPath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+
+	if err := db.WithContext(ctx).Exec("VACUUM INTO ?", tmp.Name()).Error; err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to backup database %s into %s, %v", dbName, destPath, err)
+	}
+
+	if err := os.Rename(tmp.Name(), destPath); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
+
+// Check databases periodically until entry interrupted
+func (entry *SqliteEntry) runHealthCheck() {
+	defer entry.backgroundWg.Done()
+
+	ticker := time.NewTicker(entry.healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-entry.quitChannel:
+			return
+		case <-ticker.C:
+			entry.checkHealth()
+		}
+	}
+}
+
+// Check all databases and record results
+func (entry *SqliteEntry) checkHealth() {
+	for _, innerDb := range entry.innerDbList {
+		entry.updateHealth(innerDb.name, entry.checkDatabase(innerDb))
+	}
+
+	entry.healthLock.Lock()
+	entry.healthChecked = true
+	entry.healthLock.Unlock()
+}
+
+// Record result of health check, changes of status are logged
+func (entry *SqliteEntry) updateHealth(name string, err error) {
+	entry.healthLock.Lock()
+	defer entry.healthLock.Unlock()
+
+	prev, unhealthy := entry.unhealthyDatabaseMap[name]
+	if err == nil {
+		if unhealthy {
+			delete(entry.unhealthyDatabaseMap, name)
+			entry.logger.delegate.Info(fmt.Sprintf("Database [%s] is healthy again", name))
+		}
+		return
+	}
+
+	entry.unhealthyDatabaseMap[name] = err
+	if !unhealthy || prev.Error() != err.Error() {
+		entry.logger.delegate.Warn(fmt.Sprintf("Database [%s] is unhealthy", name),
+			zap.String("entryName", entry.entryName),
+			zap.Error(err))
+	}
+}
+
+// Run SELECT 1 against database with interval as timeout, db file is checked if checkFile enabled,
+// since SELECT 1 still succeeds with opened file deleted or volume remounted as read-only.
+func (entry *SqliteEntry) checkDatabase(innerDb *databaseInner) error {
+	gormDb, ok := entry.GormDbMap[innerDb.name]
+	if !ok {
+		return fmt.Errorf("database %s is not connected", innerDb.name)
+	}
+
+	db, err := gormDb.DB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), entry.healthCheckInterval)
+	defer cancel()
+
+	var one int
+	if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return fmt.Errorf("failed to query database %s, %v", innerDb.name, err)
+	}
+
+	if !entry.healthCheckFile || innerDb.inMemory {
+		return nil
+	}
+
+	if _, err := os.Stat(innerDb.dbFile()); err != nil {
+		return fmt.Errorf("failed to check file of database %s, %v", innerDb.name, err)
+	}
+
+	if !innerDb.readOnly && onReadOnlyFS(innerDb.dbFile()) {
+		return fmt.Errorf("file %s of database %s is on read-only filesystem", innerDb.dbFile(), innerDb.name)
+	}
+
+	return nil
+}
+
+// Backup database periodically until entry interrupted
+func (entry *SqliteEntry) runBackup(innerDb *databaseInner) {
+	defer entry.backgroundWg.Done()
+
+	dir := innerDb.backupDir
+	if len(dir) < 1 {
+		dir = filepath.Join(innerDb.dbDir, "backup")
+	}
+
+	// running backup is cancelled while interrupted
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-entry.quitChannel:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(innerDb.backupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			path := filepath.Join(dir, fmt.Sprintf("%s-%s.db", innerDb.name, time.Now().UTC().Format(backupTimeLayout)))
+			if err := entry.Backup(ctx, innerDb.name, path); err != nil {
+				if ctx.Err() == nil {
+					entry.logger.delegate.Error(fmt.Sprintf("Failed to backup database [%s]", innerDb.name), zap.Error(err))
+				}
+				continue
+			}
+
+			entry.logger.delegate.Info(fmt.Sprintf("Backup database [%s] into [%s]", innerDb.name, path))
+
+			if err := pruneBackups(dir, innerDb.name, innerDb.backupRetention); err != nil {
+				entry.logger.delegate.Warn(fmt.Sprintf("Failed to remove old backups of database [%s]", innerDb.name), zap.Error(err))
+			}
+		}
+	}
+}
+
+// Remove oldest backups of database in dir if count of backups exceeds retention, zero retention keeps all backups.
+// Files are matched with name of scheduled backup, so backups of other databases in the same dir are kept.
+func pruneBackups(dir, dbName string, retention int) error {
+	if retention < 1 {
+		return nil
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	backups := make([]string, 0)
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), dbName+"-") || !strings.HasSuffix(file.Name(), ".db") {
+			continue
+		}
+
+		ts := strings.TrimSuffix(strings.TrimPrefix(file.Name(), dbName+"-"), ".db")
+		if _, err := time.Parse(backupTimeLayout, ts); err == nil {
+			backups = append(backups, file.Name())
+		}
+	}
+
+	// timestamp in UTC keeps name order same as time order
+	sort.Strings(backups)
+	for i := 0; i < len(backups)-retention; i++ {
+		if err := os.Remove(filepath.Join(dir, backups[i])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns path of database file
+func (innerDb *databaseInner) dbFile() string {
+	return filepath.ToSlash(filepath.Join(innerDb.dbDir, innerDb.name+".db"))
+}
+
+// Returns DSN of database as SQLite URI filename, file:<path>?<params> for file-backed database,
+// and file:<name>?mode=memory&cache=shared for in-memory database which could be shared by name
+// across connections in the same process.
+//
+// Params are kept in order, PRAGMA goes before params since driver reads first value of duplicated keys.
+func (innerDb *databaseInner) dsn() (string, error) {
+	path := innerDb.dbFile()
+	params := make([]string, 0)
+	if innerDb.inMemory {
+		path = innerDb.name
+		params = append(params, "mode=memory")
+	}
+	if innerDb.readOnly {
+		params = append(params, "mode=ro")
+		if innerDb.immutable {
+			params = append(params, "immutable=1")
+		}
+	}
+	// PRAGMA of encrypted database is applied after key by connector instead of driver
+	if !innerDb.encrypted() {
+		params = append(params, innerDb.pragma.params()...)
+	}
+	params = append(params, innerDb.params...)
+
+	query := make([]string, 0, len(params))
+	shared := false
+	for _, param := range params {
+		values, err := url.ParseQuery(param)
+		if err != nil {
+			return "", fmt.Errorf("invalid param [%s] of database %s, %v", param, innerDb.name, err)
+		}
+
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			for _, v := range values[k] {
+				query = append(query, url.QueryEscape(k)+"="+url.QueryEscape(v))
+			}
+			shared = shared || k == "cache"
+		}
+	}
+
+	// connections of in-memory database see different databases without shared cache
+	if innerDb.inMemory && !shared {
+		query = append(query, "cache=shared")
+	}
+
+	res := &url.URL{
+		Scheme:   "file",
+		Opaque:   (&url.URL{Path: path}).EscapedPath(),
+		RawQuery: strings.Join(query, "&"),
+	}
+
+	return res.String(), nil
+}
+
+// Returns true if file is on read-only filesystem, file is opened for writing without modification
+func onReadOnlyFS(path string) bool {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return errors.Is(err, syscall.EROFS)
+	}
+	file.Close()
+
+	return false
+}
+
+// Reject create, update and delete of read-only database before executed, and translate
+// SQLITE_READONLY returned by raw statements and migrations into ErrReadOnly.
+func registerReadOnlyCallbacks(name string, db *gorm.DB) error {
+	reject := func(tx *gorm.DB) {
+		tx.AddError(fmt.Errorf("failed to write %s, %w", name, ErrReadOnly))
+	}
+
+	translate := func(tx *gorm.DB) {
+		var sqliteErr sqlite3.Error
+		if errors.As(tx.Error, &sqliteErr) && sqliteErr.Code == sqlite3.ErrReadonly {
+			tx.Error = fmt.Errorf("failed to write %s, %w, %v", name, ErrReadOnly, sqliteErr)
+		}
+	}
+
+	callback := db.Callback()
+	for _, err := range []error{
+		callback.Create().Before("*").Register("rk:read_only", reject),
+		callback.Update().Before("*").Register("rk:read_only", reject),
+		callback.Delete().Before("*").Register("rk:read_only", reject),
+		callback.Raw().After("gorm:raw").Register("rk:read_only", translate),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns true if encryption key or key file of database is provided
+func (innerDb *databaseInner) encrypted() bool {
+	return len(innerDb.encryptionKey) > 0 || len(innerDb.encryptionKeyFile) > 0
+}
+
+// Returns encryption key of database, contents of key file override key.
+// Error message never contains the key.
+func (innerDb *databaseInner) readEncryptionKey() (string, error) {
+	if len(innerDb.encryptionKeyFile) < 1 {
+		return innerDb.encryptionKey, nil
+	}
+
+	content, err := os.ReadFile(innerDb.encryptionKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read encryption key file of database %s, %v", innerDb.name, err)
+	}
+
+	key := strings.TrimSpace(string(content))
+	if len(key) < 1 {
+		return "", fmt.Errorf("encryption key file %s of database %s is empty", innerDb.encryptionKeyFile, innerDb.name)
+	}
+
+	return key, nil
+}
+
+// Read schema of encrypted database with key applied, and make sure driver is linked with SQLCipher,
+// otherwise PRAGMA key is ignored by SQLite silently and data is stored as plaintext.
+func verifyEncryption(innerDb *databaseInner, db *gorm.DB) error {
+	if !innerDb.encrypted() {
+		return nil
+	}
+
+	var count int
+	if err := db.Raw("SELECT count(*) FROM sqlite_master").Row().Scan(&count); err != nil {
+		return fmt.Errorf("failed to open encrypted database %s, encryption key is wrong or database is not encrypted, %v",
+			innerDb.name, err)
+	}
+
+	var version string
+	if err := db.Raw("PRAGMA cipher_version").Row().Scan(&version); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read cipher_version of database %s, %v", innerDb.name, err)
+	}
+
+	if len(version) < 1 {
+		return fmt.Errorf("encryption key of database %s is provided but SQLite driver is not built with SQLCipher",
+			innerDb.name)
+	}
+
+	return nil
+}
+
+// cipherConnector opens connections of encrypted database, PRAGMA key must be executed before
+// any statement which reads database, so it is executed by connect hook of driver followed by PRAGMA.
+type cipherConnector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func newCipherConnector(dsn, key string, pragma Pragma) *cipherConnector {
+	statements := pragma.statements()
+
+	return &cipherConnector{
+		dsn: dsn,
+		driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				// statement is not included in error, since it contains the key
+				if _, err := conn.Exec("PRAGMA key = "+quoteLiteral(key), nil); err != nil {
+					return fmt.Errorf("failed to apply encryption key, %v", err)
+				}
+
+				for _, stmt := range statements {
+					if _, err := conn.Exec(stmt, nil); err != nil {
+						return fmt.Errorf("failed to execute %s, %v", stmt, err)
+					}
+				}
+
+				return nil
+			},
+		},
+	}
+}
+
+// Connect returns new connection with key and PRAGMA applied
+func (c *cipherConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+// Driver returns underlying SQLite driver
+func (c *cipherConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Quote string as SQL literal
+func quoteLiteral(in string) string {
+	return "'" + strings.ReplaceAll(in, "'", "''") + "'"
+}
+
+// Apply connection pool settings of database, driver defaults will be kept for non-positive values except maxOpenConn.
+//
+// Concurrent writers of the same file get "database is locked" errors, so file-backed database is limited
+// to 1 connection if maxOpenConn is not provided.
+func (entry *SqliteEntry) applyPool(innerDb *databaseInner, db *gorm.DB) error {
+	inner, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	// there are no writers of read-only database
+	maxOpenConn := innerDb.maxOpenConn
+	if maxOpenConn == 0 && !innerDb.inMemory && !innerDb.readOnly {
+		maxOpenConn = 1
+		entry.logger.delegate.Info(fmt.Sprintf("Limit max open connections of database [%s] to 1 to prevent SQLITE_BUSY "+
+			"of concurrent writers, set maxOpenConn to override", innerDb.name))
+	}
+
+	if maxOpenConn > 0 {
+		inner.SetMaxOpenConns(maxOpenConn)
+	}
+
+	if innerDb.maxIdleConn > 0 {
+		inner.SetMaxIdleConns(innerDb.maxIdleConn)
+	}
+
+	if innerDb.connMaxLifetime > 0 {
+		inner.SetConnMaxLifetime(innerDb.connMaxLifetime)
+	}
+
+	return nil
+}
+
+// Validate values of PRAGMA, values are case-insensitive
+func (p *Pragma) validate() error {
+	switch strings.ToUpper(p.JournalMode) {
+	case "", "DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF":
+	default:
+		return fmt.Errorf("invalid journalMode %s, expected one of [DELETE, TRUNCATE, PERSIST, MEMORY, WAL, OFF]", p.JournalMode)
+	}
+
+	switch strings.ToUpper(p.Synchronous) {
+	case "", "OFF", "NORMAL", "FULL", "EXTRA":
+	default:
+		return fmt.Errorf("invalid synchronous %s, expected one of [OFF, NORMAL, FULL, EXTRA]", p.Synchronous)
+	}
+
+	if p.BusyTimeout < 0 {
+		return errors.New("busyTimeout must not be negative")
+	}
+
+	return nil
+}
+
+// Returns name and value pairs of PRAGMA in order, empty fields are skipped
+func (p *Pragma) values() [][2]string {
+	res := make([][2]string, 0)
+
+	if len(p.JournalMode) > 0 {
+		res = append(res, [2]string{"journal_mode", strings.ToUpper(p.JournalMode)})
+	}
+
+	if p.BusyTimeout > 0 {
+		res = append(res, [2]string{"busy_timeout", strconv.FormatInt(p.BusyTimeout.Milliseconds(), 10)})
+	}
+
+	if p.ForeignKeys != nil {
+		res = append(res, [2]string{"foreign_keys", strconv.FormatInt(boolToInt(*p.ForeignKeys), 10)})
+	}
+
+	if len(p.Synchronous) > 0 {
+		res = append(res, [2]string{"synchronous", strings.ToUpper(p.Synchronous)})
+	}
+
+	return res
+}
+
+// Returns DSN params of PRAGMA which are applied by driver to every connection
+func (p *Pragma) params() []string {
+	res := make([]string, 0)
+
+	for _, v := range p.values() {
+		res = append(res, "_"+v[0]+"="+v[1])
+	}
+
+	return res
+}
+
+// Returns PRAGMA statements which are executed by connector of encrypted database
+func (p *Pragma) statements() []string {
+	res := make([]string, 0)
+
+	for _, v := range p.values() {
+		res = append(res, "PRAGMA "+v[0]+" = "+v[1])
+	}
+
+	return res
+}
+
+// Read PRAGMA back from database and compare with expected values.
+//
+// SQLite keeps journal mode of in-memory database as MEMORY, so mismatched journal mode is logged only.
+func (entry *SqliteEntry) verifyPragma(innerDb *databaseInner, db *gorm.DB) error {
+	p := innerDb.pragma
+
+	if len(p.JournalMode) > 0 {
+		var mode string
+		if err := db.Raw("PRAGMA journal_mode").Row().Scan(&mode); err != nil {
+			return fmt.Errorf("failed to read journal_mode of database %s, %v", innerDb.name, err)
+		}
+		if !strings.EqualFold(mode, p.JournalMode) {
+			entry.logger.delegate.Warn(fmt.Sprintf("Journal mode of database [%s] is %s instead of %s", innerDb.name, mode, p.JournalMode))
+		}
+	}
+
+	// synchronous is returned as number
+	synchronous := map[string]int{"OFF": 0, "NORMAL": 1, "FULL": 2, "EXTRA": 3}
+
+	for _, v := range []struct {
+		pragma   string
+		enabled  bool
+		expected int64
+	}{
+		{"busy_timeout", p.BusyTimeout > 0, p.BusyTimeout.Milliseconds()},
+		{"foreign_keys", p.ForeignKeys != nil, boolToInt(p.ForeignKeys != nil && *p.ForeignKeys)},
+		{"synchronous", len(p.Synchronous) > 0, int64(synchronous[strings.ToUpper(p.Synchronous)])},
+	} {
+		if !v.enabled {
+			continue
+		}
+
+		var actual int64
+		if err := db.Raw("PRAGMA " + v.pragma).Row().Scan(&actual); err != nil {
+			return fmt.Errorf("failed to read %s of database %s, %v", v.pragma, innerDb.name, err)
+		}
+		if actual != v.expected {
+			return fmt.Errorf("%s of database %s is %d, expected %d", v.pragma, innerDb.name, actual, v.expected)
+		}
+	}
+
+	return nil
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
 // Copy zap.Config
 func copyZapLoggerConfig(src *zap.Config) *zap.Config {
 	res := &zap.Config{
@@ -526,6 +1493,46 @@ func GetSqliteEntry(name string) *SqliteEntry {
 	return nil
 }
 
+// Expand ${NAME} and ${NAME:-default} with environment variables, $$ is escaped as a literal $.
+//
+// Error will be returned if variable is not set and no default value provided.
+func expandEnv(in string) (string, error) {
+	res := strings.Builder{}
+
+	for i := 0; i < len(in); i++ {
+		if in[i] != '$' || i+1 >= len(in) {
+			res.WriteByte(in[i])
+			continue
+		}
+
+		switch in[i+1] {
+		case '$':
+			res.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(in[i+2:], '}')
+			if end < 0 {
+				// do not print input which may be encryption key
+				return "", fmt.Errorf("missing closing brace of variable at position %d", i)
+			}
+
+			name, def, hasDef := strings.Cut(in[i+2:i+2+end], ":-")
+			if val, ok := os.LookupEnv(name); ok {
+				res.WriteString(val)
+			} else if hasDef {
+				res.WriteString(def)
+			} else {
+				return "", fmt.Errorf("environment variable %s is not set", name)
+			}
+			i += end + 2
+		default:
+			res.WriteByte(in[i])
+		}
+	}
+
+	return res.String(), nil
+}
+
 // Make incoming paths to absolute path with current working directory attached as prefix
 func toAbsPath(p ...string) []string {
 	res := make([]string, 0)
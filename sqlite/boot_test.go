@@ -6,10 +6,21 @@ package rksqlite
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/rookie-ninja/rk-entry/v2/entry"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestRegisterSqliteEntry(t *testing.T) {
@@ -54,6 +65,138 @@ func TestSqliteEntry_IsHealthy(t *testing.T) {
 	defer entry.Interrupt(context.TODO())
 }
 
+func TestSqliteEntry_HealthCheck(t *testing.T) {
+	dir := t.TempDir()
+	core, logs := observer.New(zap.InfoLevel)
+
+	entry := RegisterSqliteEntry(
+		WithName("ut-health-check"),
+		WithLogger(&Logger{delegate: zap.New(core), LogLevel: gormLogger.Warn}),
+		WithHealthCheck(10*time.Millisecond, true),
+		WithDatabase("ut-database", dir, false, false),
+		WithDatabase("ut-memory", "", false, true))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.Bootstrap(context.TODO())
+
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, entry.IsHealthy())
+
+	// db file deleted
+	dbFile := filepath.Join(dir, "ut-database.db")
+	assert.Nil(t, os.Rename(dbFile, dbFile+".bak"))
+	assert.Eventually(t, func() bool {
+		return !entry.IsHealthy()
+	}, time.Second, 10*time.Millisecond)
+
+	// cause is logged once
+	time.Sleep(30 * time.Millisecond)
+	unhealthyLogs := logs.FilterMessage("Database [ut-database] is unhealthy").All()
+	assert.Len(t, unhealthyLogs, 1)
+	assert.Contains(t, unhealthyLogs[0].ContextMap()["error"], "failed to check file of database ut-database")
+
+	// recovered
+	assert.Nil(t, os.Rename(dbFile+".bak", dbFile))
+	assert.Eventually(t, entry.IsHealthy, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, logs.FilterMessage("Database [ut-database] is healthy again").Len())
+	assert.Zero(t, logs.FilterMessage("Database [ut-memory] is unhealthy").Len())
+
+	// stopped by interrupt
+	entry.Interrupt(context.TODO())
+	count := logs.Len()
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, count, logs.Len())
+
+	// not connected
+	assert.EqualError(t, entry.checkDatabase(&databaseInner{name: "ut-missing"}), "database ut-missing is not connected")
+
+	// closed
+	err := entry.checkDatabase(entry.getInnerDb("ut-database"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to query database ut-database")
+}
+
+func TestSqliteEntry_HealthCheckOnBootstrap(t *testing.T) {
+	dir := t.TempDir()
+
+	entry := RegisterSqliteEntry(
+		WithName("ut-health-check-on-bootstrap"),
+		WithHealthCheck(time.Hour, true),
+		WithDatabase("ut-database", dir, false, false))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// not checked yet
+	assert.False(t, entry.IsHealthy())
+
+	// checked while bootstrapping, without waiting for interval
+	entry.Bootstrap(context.TODO())
+	defer entry.Interrupt(context.TODO())
+	assert.True(t, entry.IsHealthy())
+
+	// result of check is reported
+	dbFile := filepath.Join(dir, "ut-database.db")
+	assert.Nil(t, os.Rename(dbFile, dbFile+".bak"))
+	entry.checkHealth()
+	assert.False(t, entry.IsHealthy())
+}
+
+func TestSqliteEntry_HealthCheckWithoutFile(t *testing.T) {
+	dir := t.TempDir()
+
+	entry := RegisterSqliteEntry(
+		WithName("ut-health-check-without-file"),
+		WithHealthCheck(10*time.Millisecond, false),
+		WithDatabase("ut-database", dir, false, false))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.Bootstrap(context.TODO())
+	defer entry.Interrupt(context.TODO())
+
+	// opened file could be queried even if deleted
+	dbFile := filepath.Join(dir, "ut-database.db")
+	assert.Nil(t, os.Rename(dbFile, dbFile+".bak"))
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, entry.IsHealthy())
+
+	// YAML
+	bootConfigStr := `
+sqlite:
+  - name: ut-health-check-yaml
+    enabled: true
+    healthCheck:
+      enabled: true
+      checkFile: true
+    database:
+      - name: ut-database
+  - name: ut-health-check-yaml-interval
+    enabled: true
+    healthCheck:
+      enabled: true
+      intervalMs: 1000
+    database:
+      - name: ut-database
+  - name: ut-health-check-yaml-disabled
+    enabled: true
+    database:
+      - name: ut-database
+`
+	entries := RegisterSqliteEntryYAML([]byte(bootConfigStr))
+	for name := range entries {
+		defer rkentry.GlobalAppCtx.RemoveEntry(entries[name])
+	}
+
+	yamlEntry := entries["ut-health-check-yaml"].(*SqliteEntry)
+	assert.True(t, yamlEntry.healthCheckEnabled)
+	assert.True(t, yamlEntry.healthCheckFile)
+	assert.Equal(t, 5*time.Second, yamlEntry.healthCheckInterval)
+
+	yamlEntry = entries["ut-health-check-yaml-interval"].(*SqliteEntry)
+	assert.True(t, yamlEntry.healthCheckEnabled)
+	assert.False(t, yamlEntry.healthCheckFile)
+	assert.Equal(t, time.Second, yamlEntry.healthCheckInterval)
+
+	yamlEntry = entries["ut-health-check-yaml-disabled"].(*SqliteEntry)
+	assert.False(t, yamlEntry.healthCheckEnabled)
+}
+
 func TestCopyZapLoggerConfig(t *testing.T) {
 	src := &zap.Config{
 		Level:             zap.NewAtomicLevel(),
@@ -127,6 +270,739 @@ func TestSqliteEntry_Bootstrap(t *testing.T) {
 	assert.True(t, entry.IsHealthy())
 }
 
+func TestSqliteEntry_Pragma(t *testing.T) {
+	dir := t.TempDir()
+	enabled := true
+
+	entry := RegisterSqliteEntry(
+		WithName("ut-pragma"),
+		WithDatabase("ut-database", dir, false, false),
+		WithPragma("ut-database", Pragma{
+			JournalMode: "wal",
+			BusyTimeout: 3 * time.Second,
+			ForeignKeys: &enabled,
+			Synchronous: "full",
+		}),
+		WithMaxOpenConn("ut-database", -1),
+		WithDatabase("ut-default", dir, false, false))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.Bootstrap(context.TODO())
+	defer entry.Interrupt(context.TODO())
+
+	db := entry.GetDB("ut-database")
+	assert.Equal(t, "file:"+filepath.ToSlash(filepath.Join(dir, "ut-database.db"))+
+		"?_journal_mode=WAL&_busy_timeout=3000&_foreign_keys=1&_synchronous=FULL&cache=shared",
+		db.Dialector.(*sqlite.Dialector).DSN)
+
+	// every connection of pool is configured
+	sqlDb, err := db.DB()
+	assert.Nil(t, err)
+	conns := make([]*sql.Conn, 0)
+	for i := 0; i < 3; i++ {
+		conn, err := sqlDb.Conn(context.TODO())
+		assert.Nil(t, err)
+		conns = append(conns, conn)
+
+		var mode string
+		var timeout, fk, sync int
+		assert.Nil(t, conn.QueryRowContext(context.TODO(), "PRAGMA journal_mode").Scan(&mode))
+		assert.Nil(t, conn.QueryRowContext(context.TODO(), "PRAGMA busy_timeout").Scan(&timeout))
+		assert.Nil(t, conn.QueryRowContext(context.TODO(), "PRAGMA foreign_keys").Scan(&fk))
+		assert.Nil(t, conn.QueryRowContext(context.TODO(), "PRAGMA synchronous").Scan(&sync))
+		assert.Equal(t, "wal", mode)
+		assert.Equal(t, 3000, timeout)
+		assert.Equal(t, 1, fk)
+		assert.Equal(t, 2, sync)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	// defaults are kept
+	db = entry.GetDB("ut-default")
+	assert.Equal(t, "file:"+filepath.ToSlash(filepath.Join(dir, "ut-default.db"))+"?cache=shared",
+		db.Dialector.(*sqlite.Dialector).DSN)
+	var mode string
+	assert.Nil(t, db.Raw("PRAGMA journal_mode").Row().Scan(&mode))
+	assert.Equal(t, "delete", mode)
+
+	// YAML
+	bootConfigStr := `
+sqlite:
+  - name: ut-pragma-yaml
+    enabled: true
+    database:
+      - name: ut-database
+        journalMode: WAL
+        busyTimeoutMs: 5000
+        foreignKeys: false
+        synchronous: NORMAL
+`
+	entries := RegisterSqliteEntryYAML([]byte(bootConfigStr))
+	yamlEntry := entries["ut-pragma-yaml"].(*SqliteEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(yamlEntry)
+	pragma := yamlEntry.getInnerDb("ut-database").pragma
+	assert.Equal(t, "WAL", pragma.JournalMode)
+	assert.Equal(t, 5*time.Second, pragma.BusyTimeout)
+	assert.False(t, *pragma.ForeignKeys)
+	assert.Equal(t, "NORMAL", pragma.Synchronous)
+	assert.Equal(t, []string{"_journal_mode=WAL", "_busy_timeout=5000", "_foreign_keys=0", "_synchronous=NORMAL"},
+		pragma.params())
+
+	// invalid
+	assert.PanicsWithError(t, "invalid pragma of database ut-database, invalid journalMode wall, "+
+		"expected one of [DELETE, TRUNCATE, PERSIST, MEMORY, WAL, OFF]", func() {
+		RegisterSqliteEntry(
+			WithName("ut-pragma-invalid"),
+			WithDatabase("ut-database", dir, false, false),
+			WithPragma("ut-database", Pragma{JournalMode: "wall"}))
+	})
+	assert.EqualError(t, (&Pragma{Synchronous: "fast"}).validate(),
+		"invalid synchronous fast, expected one of [OFF, NORMAL, FULL, EXTRA]")
+	assert.EqualError(t, (&Pragma{BusyTimeout: -time.Second}).validate(), "busyTimeout must not be negative")
+}
+
+func TestDatabaseInner_Dsn(t *testing.T) {
+	enabled := true
+
+	// file-backed database with default params
+	inner := &databaseInner{name: "ut-database", dbDir: "/tmp/ut", params: []string{"cache=shared"}}
+	dsn, err := inner.dsn()
+	assert.Nil(t, err)
+	assert.Equal(t, "file:/tmp/ut/ut-database.db?cache=shared", dsn)
+
+	// file-backed database without params
+	inner = &databaseInner{name: "ut-database", dbDir: "/tmp/ut", params: []string{}}
+	dsn, err = inner.dsn()
+	assert.Nil(t, err)
+	assert.Equal(t, "file:/tmp/ut/ut-database.db", dsn)
+
+	// special characters in path are escaped
+	inner = &databaseInner{name: "ut?database", dbDir: "/tmp/ut dir#1", params: []string{}}
+	dsn, err = inner.dsn()
+	assert.Nil(t, err)
+	assert.Equal(t, "file:/tmp/ut%20dir%231/ut%3Fdatabase.db", dsn)
+
+	// in-memory database is named by database name
+	inner = &databaseInner{name: "ut-database", dbDir: "/tmp/ut", inMemory: true, params: []string{"cache=shared"}}
+	dsn, err = inner.dsn()
+	assert.Nil(t, err)
+	assert.Equal(t, "file:ut-database?mode=memory&cache=shared", dsn)
+
+	// in-memory database always has cache param
+	inner = &databaseInner{name: "ut-database", inMemory: true, params: []string{"_loc=auto"}}
+	dsn, err = inner.dsn()
+	assert.Nil(t, err)
+	assert.Equal(t, "file:ut-database?mode=memory&_loc=auto&cache=shared", dsn)
+
+	// custom params are kept in order after PRAGMA, and escaped
+	inner = &databaseInner{
+		name:   "ut-database",
+		dbDir:  "/tmp/ut",
+		params: []string{"_txlock=immediate", "_loc=Asia/Shanghai", "_auth_pass=a%26b", "cache=private"},
+		pragma: Pragma{JournalMode: "wal", ForeignKeys: &enabled},
+	}
+	dsn, err = inner.dsn()
+	assert.Nil(t, err)
+	assert.Equal(t, "file:/tmp/ut/ut-database.db?_journal_mode=WAL&_foreign_keys=1"+
+		"&_txlock=immediate&_loc=Asia%2FShanghai&_auth_pass=a%26b&cache=private", dsn)
+
+	// invalid param
+	inner = &databaseInner{name: "ut-database", params: []string{"_loc=%zz"}}
+	dsn, err = inner.dsn()
+	assert.NotNil(t, err)
+	assert.Empty(t, dsn)
+}
+
+func TestSqliteEntry_SharedMemory(t *testing.T) {
+	type utRecord struct {
+		Id int `gorm:"primaryKey"`
+	}
+
+	first := RegisterSqliteEntry(
+		WithName("ut-memory-first"),
+		WithDatabase("ut-shared-memory", "", false, true))
+	defer rkentry.GlobalAppCtx.RemoveEntry(first)
+	first.Bootstrap(context.TODO())
+	defer first.Interrupt(context.TODO())
+
+	second := RegisterSqliteEntry(
+		WithName("ut-memory-second"),
+		WithDatabase("ut-shared-memory", "", false, true))
+	defer rkentry.GlobalAppCtx.RemoveEntry(second)
+	second.Bootstrap(context.TODO())
+	defer second.Interrupt(context.TODO())
+
+	assert.Equal(t, "file:ut-shared-memory?mode=memory&cache=shared",
+		first.GetDB("ut-shared-memory").Dialector.(*sqlite.Dialector).DSN)
+
+	// record created by first entry is visible from second entry
+	assert.Nil(t, first.GetDB("ut-shared-memory").AutoMigrate(&utRecord{}))
+	assert.Nil(t, first.GetDB("ut-shared-memory").Create(&utRecord{Id: 1}).Error)
+
+	var count int64
+	assert.Nil(t, second.GetDB("ut-shared-memory").Model(&utRecord{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// no file is created
+	_, err := os.Stat("ut-shared-memory.db")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSqliteEntry_Encryption(t *testing.T) {
+	dir := t.TempDir()
+	key := "ut-secret-'key"
+	core, logs := observer.New(zap.DebugLevel)
+	enabled := true
+
+	entry := RegisterSqliteEntry(
+		WithName("ut-encryption"),
+		WithLogger(&Logger{delegate: zap.New(core), LogLevel: gormLogger.Info}),
+		WithDatabase("ut-database", dir, false, false),
+		WithPragma("ut-database", Pragma{JournalMode: "wal", ForeignKeys: &enabled}),
+		WithEncryptionKey("ut-database", key))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// PRAGMA and key are not passed to driver by DSN
+	inner := entry.getInnerDb("ut-database")
+	dsn, err := inner.dsn()
+	assert.Nil(t, err)
+	assert.Equal(t, "file:"+filepath.ToSlash(filepath.Join(dir, "ut-database.db"))+"?cache=shared", dsn)
+
+	// SQLite linked in test is not SQLCipher, which must not be treated as encrypted
+	err = entry.connect()
+	assert.EqualError(t, err, "encryption key of database ut-database is provided but SQLite driver is not built with SQLCipher")
+	assert.NotContains(t, entry.String(), key)
+	for _, log := range logs.All() {
+		assert.NotContains(t, log.Message, key)
+		assert.NotContains(t, fmt.Sprintf("%v", log.ContextMap()), key)
+	}
+
+	// bootstrap fails
+	assert.PanicsWithError(t, "failed to connect to database, encryption key of database ut-database is provided "+
+		"but SQLite driver is not built with SQLCipher", func() {
+		entry.Bootstrap(context.TODO())
+	})
+
+	// file which is not a database is treated as wrong key
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "ut-garbage.db"), []byte("not a database, not a database"), 0600))
+	garbage := RegisterSqliteEntry(
+		WithName("ut-encryption-garbage"),
+		WithDatabase("ut-garbage", dir, false, false),
+		WithEncryptionKey("ut-garbage", key))
+	defer rkentry.GlobalAppCtx.RemoveEntry(garbage)
+	err = garbage.connect()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to open encrypted database ut-garbage, encryption key is wrong or database is not encrypted")
+	assert.NotContains(t, err.Error(), key)
+
+	// in-memory database could not be encrypted
+	assert.PanicsWithError(t, "encryption key is not supported by in-memory database ut-database", func() {
+		RegisterSqliteEntry(
+			WithName("ut-encryption-memory"),
+			WithDatabase("ut-database", "", false, true),
+			WithEncryptionKey("ut-database", key))
+	})
+	rkentry.GlobalAppCtx.RemoveEntry(rkentry.GlobalAppCtx.GetEntry(SqliteEntryType, "ut-encryption-memory"))
+}
+
+func TestCipherConnector(t *testing.T) {
+	enabled := true
+	dsn := "file:" + filepath.ToSlash(filepath.Join(t.TempDir(), "ut-database.db"))
+
+	// key and PRAGMA are applied to every connection
+	db := sql.OpenDB(newCipherConnector(dsn, "ut-key", Pragma{ForeignKeys: &enabled, Synchronous: "full"}))
+	defer db.Close()
+
+	conns := make([]*sql.Conn, 0)
+	for i := 0; i < 2; i++ {
+		conn, err := db.Conn(context.TODO())
+		assert.Nil(t, err)
+		conns = append(conns, conn)
+
+		var fk, sync int
+		assert.Nil(t, conn.QueryRowContext(context.TODO(), "PRAGMA foreign_keys").Scan(&fk))
+		assert.Nil(t, conn.QueryRowContext(context.TODO(), "PRAGMA synchronous").Scan(&sync))
+		assert.Equal(t, 1, fk)
+		assert.Equal(t, 2, sync)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	assert.Equal(t, []string{"PRAGMA foreign_keys = 1", "PRAGMA synchronous = FULL"},
+		(&Pragma{ForeignKeys: &enabled, Synchronous: "full"}).statements())
+	assert.Equal(t, "'it''s'", quoteLiteral("it's"))
+}
+
+func TestDatabaseInner_ReadEncryptionKey(t *testing.T) {
+	dir := t.TempDir()
+
+	// without key file
+	inner := &databaseInner{name: "ut-database", encryptionKey: "ut-key"}
+	assert.True(t, inner.encrypted())
+	key, err := inner.readEncryptionKey()
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-key", key)
+
+	// key file overrides key
+	keyFile := filepath.Join(dir, "key")
+	assert.Nil(t, os.WriteFile(keyFile, []byte(" ut-file-key\n"), 0600))
+	inner.encryptionKeyFile = keyFile
+	key, err = inner.readEncryptionKey()
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-file-key", key)
+
+	// empty key file
+	assert.Nil(t, os.WriteFile(keyFile, []byte("\n"), 0600))
+	key, err = inner.readEncryptionKey()
+	assert.EqualError(t, err, fmt.Sprintf("encryption key file %s of database ut-database is empty", keyFile))
+	assert.Empty(t, key)
+
+	// missing key file
+	inner.encryptionKeyFile = filepath.Join(dir, "missing")
+	_, err = inner.readEncryptionKey()
+	assert.NotNil(t, err)
+
+	// not encrypted
+	assert.False(t, (&databaseInner{}).encrypted())
+}
+
+func TestRegisterSqliteEntryYAML_Encryption(t *testing.T) {
+	t.Setenv("UT_SQLITE_KEY", "ut-env-key")
+
+	bootConfigStr := `
+sqlite:
+  - name: ut-encryption-yaml
+    enabled: true
+    database:
+      - name: ut-env
+        encryptionKey: ${UT_SQLITE_KEY}
+        encryptionKeyFile: /ut/ignored
+      - name: ut-file
+        encryptionKey: ut-key
+        encryptionKeyFile: /ut/${UT_SQLITE_KEY:-none}
+      - name: ut-plain
+`
+	entries := RegisterSqliteEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-encryption-yaml"].(*SqliteEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.Equal(t, "ut-env-key", entry.getInnerDb("ut-env").encryptionKey)
+	assert.Empty(t, entry.getInnerDb("ut-env").encryptionKeyFile)
+	assert.Equal(t, "ut-key", entry.getInnerDb("ut-file").encryptionKey)
+	assert.Equal(t, "/ut/ut-env-key", entry.getInnerDb("ut-file").encryptionKeyFile)
+	assert.False(t, entry.getInnerDb("ut-plain").encrypted())
+
+	// missing variable
+	bootConfigStr = `
+sqlite:
+  - name: ut-encryption-yaml-missing
+    enabled: true
+    database:
+      - name: ut-database
+        encryptionKey: ${UT_SQLITE_KEY_MISSING}
+`
+	assert.PanicsWithError(t, "failed to expand config of SqliteEntry ut-encryption-yaml-missing, "+
+		"environment variable UT_SQLITE_KEY_MISSING is not set", func() {
+		RegisterSqliteEntryYAML([]byte(bootConfigStr))
+	})
+}
+
+func TestSqliteEntry_Backup(t *testing.T) {
+	type utRecord struct {
+		Id int `gorm:"primaryKey"`
+	}
+
+	dir := t.TempDir()
+	entry := RegisterSqliteEntry(
+		WithName("ut-backup"),
+		WithDatabase("ut-database", dir, false, false),
+		WithDatabase("ut-memory", "", false, true),
+		WithDatabase("ut-dry-run", dir, true, false))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.Bootstrap(context.TODO())
+	defer entry.Interrupt(context.TODO())
+
+	db := entry.GetDB("ut-database")
+	assert.Nil(t, db.AutoMigrate(&utRecord{}))
+	assert.Nil(t, db.Create(&utRecord{Id: 1}).Error)
+
+	countOf := func(path string) int64 {
+		backup, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+		assert.Nil(t, err)
+		defer closeDB(backup)
+		var count int64
+		assert.Nil(t, backup.Model(&utRecord{}).Count(&count).Error)
+		return count
+	}
+
+	// parent directories are created
+	dest := filepath.Join(dir, "nested", "dir", "ut-database.db")
+	assert.Nil(t, entry.Backup(context.TODO(), "ut-database", dest))
+	assert.Equal(t, int64(1), countOf(dest))
+
+	// existing file is not overwritten
+	assert.Nil(t, db.Create(&utRecord{Id: 2}).Error)
+	assert.EqualError(t, entry.Backup(context.TODO(), "ut-database", dest),
+		fmt.Sprintf("backup file %s already exists", dest))
+	assert.Equal(t, int64(1), countOf(dest))
+
+	// unless overwrite requested
+	assert.Nil(t, entry.BackupOverwrite(context.TODO(), "ut-database", dest))
+	assert.Equal(t, int64(2), countOf(dest))
+
+	// no temp file left
+	files, err := os.ReadDir(filepath.Dir(dest))
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+
+	// in-memory database
+	assert.Nil(t, entry.GetDB("ut-memory").AutoMigrate(&utRecord{}))
+	assert.Nil(t, entry.GetDB("ut-memory").Create(&utRecord{Id: 1}).Error)
+	memoryDest := filepath.Join(dir, "ut-memory.db")
+	assert.Nil(t, entry.Backup(context.TODO(), "ut-memory", memoryDest))
+	assert.Equal(t, int64(1), countOf(memoryDest))
+
+	// missing database
+	assert.EqualError(t, entry.Backup(context.TODO(), "ut-missing", filepath.Join(dir, "ut-missing.db")),
+		"database ut-missing not found")
+
+	// dry run
+	assert.EqualError(t, entry.Backup(context.TODO(), "ut-dry-run", filepath.Join(dir, "ut-dry-run-backup.db")),
+		"database ut-dry-run is in dry run mode")
+
+	// cancelled context
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	assert.NotNil(t, entry.Backup(ctx, "ut-database", filepath.Join(dir, "ut-cancelled.db")))
+	_, err = os.Stat(filepath.Join(dir, "ut-cancelled.db"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSqliteEntry_ScheduledBackup(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "backup")
+
+	entry := RegisterSqliteEntry(
+		WithName("ut-scheduled-backup"),
+		WithDatabase("ut-database", dir, false, false),
+		WithBackup("ut-database", 10*time.Millisecond, "", 2))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.Bootstrap(context.TODO())
+
+	// backup of other database is kept
+	assert.Nil(t, os.MkdirAll(backupDir, os.ModePerm))
+	other := filepath.Join(backupDir, "ut-database-other-20260101T000000.000Z.db")
+	assert.Nil(t, os.WriteFile(other, []byte{}, 0600))
+
+	listBackups := func() []string {
+		res, _ := filepath.Glob(filepath.Join(backupDir, "ut-database-2*.db"))
+		return res
+	}
+
+	// stopped by interrupt, retention is applied after every backup
+	time.Sleep(100 * time.Millisecond)
+	entry.Interrupt(context.TODO())
+	backups := listBackups()
+	assert.Len(t, backups, 2)
+	_, err := os.Stat(other)
+	assert.Nil(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, backups, listBackups())
+
+	// interrupt twice
+	assertNotPanic(t)
+	entry.Interrupt(context.TODO())
+
+	// invalid config
+	assert.PanicsWithError(t, "backup interval and retention of database ut-database must not be negative", func() {
+		RegisterSqliteEntry(
+			WithName("ut-scheduled-backup-invalid"),
+			WithDatabase("ut-database", dir, false, false),
+			WithBackup("ut-database", time.Second, "", -1))
+	})
+	rkentry.GlobalAppCtx.RemoveEntry(rkentry.GlobalAppCtx.GetEntry(SqliteEntryType, "ut-scheduled-backup-invalid"))
+
+	// YAML
+	bootConfigStr := `
+sqlite:
+  - name: ut-scheduled-backup-yaml
+    enabled: true
+    database:
+      - name: ut-default
+        backup:
+          enabled: true
+      - name: ut-database
+        backup:
+          enabled: true
+          intervalMs: 60000
+          dir: /ut/backup
+          retention: 7
+`
+	entries := RegisterSqliteEntryYAML([]byte(bootConfigStr))
+	yamlEntry := entries["ut-scheduled-backup-yaml"].(*SqliteEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(yamlEntry)
+	inner := yamlEntry.getInnerDb("ut-default")
+	assert.Equal(t, time.Hour, inner.backupInterval)
+	assert.Empty(t, inner.backupDir)
+	assert.Zero(t, inner.backupRetention)
+	inner = yamlEntry.getInnerDb("ut-database")
+	assert.Equal(t, time.Minute, inner.backupInterval)
+	assert.Equal(t, "/ut/backup", inner.backupDir)
+	assert.Equal(t, 7, inner.backupRetention)
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"ut-database-20260101T000000.000Z.db",
+		"ut-database-20260102T000000.000Z.db",
+		"ut-database-20260103T000000.000Z.db",
+		"ut-database-archive-20260101T000000.000Z.db",
+		"ut-database-manual.db",
+	}
+	for _, name := range names {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte{}, 0600))
+	}
+
+	// zero retention keeps all
+	assert.Nil(t, pruneBackups(dir, "ut-database", 0))
+	files, _ := os.ReadDir(dir)
+	assert.Len(t, files, 5)
+
+	assert.Nil(t, pruneBackups(dir, "ut-database", 1))
+	files, _ = os.ReadDir(dir)
+	res := make([]string, 0)
+	for _, file := range files {
+		res = append(res, file.Name())
+	}
+	assert.ElementsMatch(t, []string{
+		"ut-database-20260103T000000.000Z.db",
+		"ut-database-archive-20260101T000000.000Z.db",
+		"ut-database-manual.db",
+	}, res)
+
+	// missing dir
+	assert.NotNil(t, pruneBackups(filepath.Join(dir, "missing"), "ut-database", 1))
+}
+
+func TestSqliteEntry_ReadOnly(t *testing.T) {
+	type utRecord struct {
+		Id    int `gorm:"primaryKey"`
+		Value string
+	}
+	type utOther struct {
+		Id int `gorm:"primaryKey"`
+	}
+
+	dir := t.TempDir()
+
+	// prepare reference database
+	writer := RegisterSqliteEntry(
+		WithName("ut-read-only-writer"),
+		WithDatabase("ut-database", dir, false, false))
+	defer rkentry.GlobalAppCtx.RemoveEntry(writer)
+	writer.Bootstrap(context.TODO())
+	assert.Nil(t, writer.GetDB("ut-database").AutoMigrate(&utRecord{}))
+	assert.Nil(t, writer.GetDB("ut-database").Create(&utRecord{Id: 1, Value: "ut"}).Error)
+	writer.Interrupt(context.TODO())
+
+	entry := RegisterSqliteEntry(
+		WithName("ut-read-only"),
+		WithDatabase("ut-database", dir, false, false),
+		WithReadOnly("ut-database"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.Bootstrap(context.TODO())
+	defer entry.Interrupt(context.TODO())
+
+	db := entry.GetDB("ut-database")
+	assert.Equal(t, "file:"+filepath.ToSlash(filepath.Join(dir, "ut-database.db"))+"?mode=ro&cache=shared",
+		db.Dialector.(*sqlite.Dialector).DSN)
+
+	// no writers, pool is not limited
+	sqlDb, err := db.DB()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, sqlDb.Stats().MaxOpenConnections)
+
+	// read
+	record := &utRecord{}
+	assert.Nil(t, db.First(record, 1).Error)
+	assert.Equal(t, "ut", record.Value)
+
+	// writes fail fast
+	err = db.Create(&utRecord{Id: 2}).Error
+	assert.True(t, errors.Is(err, ErrReadOnly))
+	assert.EqualError(t, err, "failed to write ut-database, database is read-only")
+	assert.True(t, errors.Is(db.Model(record).Update("value", "new").Error, ErrReadOnly))
+	assert.True(t, errors.Is(db.Delete(record).Error, ErrReadOnly))
+
+	// raw statements and migrations
+	assert.True(t, errors.Is(db.Exec("INSERT INTO ut_records (id, value) VALUES (3, 'ut')").Error, ErrReadOnly))
+	err = db.AutoMigrate(&utOther{})
+	assert.True(t, errors.Is(err, ErrReadOnly))
+	assert.Contains(t, err.Error(), "failed to write ut-database, database is read-only")
+
+	var count int64
+	assert.Nil(t, db.Model(&utRecord{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// backup of read-only database
+	assert.Nil(t, entry.Backup(context.TODO(), "ut-database", filepath.Join(dir, "backup", "ut-database.db")))
+
+	// read-only database is never created
+	missing := RegisterSqliteEntry(
+		WithName("ut-read-only-missing"),
+		WithDatabase("ut-database", filepath.Join(dir, "missing"), false, false),
+		WithReadOnly("ut-database"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(missing)
+	err = missing.connect()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to open read-only database ut-database")
+	_, err = os.Stat(filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(err))
+
+	// immutable
+	inner := &databaseInner{name: "ut-database", dbDir: "/tmp/ut", readOnly: true, immutable: true, params: []string{"cache=shared"}}
+	dsn, err := inner.dsn()
+	assert.Nil(t, err)
+	assert.Equal(t, "file:/tmp/ut/ut-database.db?mode=ro&immutable=1&cache=shared", dsn)
+	assert.False(t, onReadOnlyFS(filepath.Join(dir, "ut-database.db")))
+
+	// invalid config
+	assert.PanicsWithError(t, "read-only is not supported by in-memory database ut-database", func() {
+		RegisterSqliteEntry(
+			WithName("ut-read-only-invalid"),
+			WithDatabase("ut-database", "", false, true),
+			WithReadOnly("ut-database"))
+	})
+	rkentry.GlobalAppCtx.RemoveEntry(rkentry.GlobalAppCtx.GetEntry(SqliteEntryType, "ut-read-only-invalid"))
+
+	assert.PanicsWithError(t, "journalMode could not be changed by read-only database ut-database", func() {
+		RegisterSqliteEntry(
+			WithName("ut-read-only-invalid"),
+			WithDatabase("ut-database", dir, false, false),
+			WithReadOnly("ut-database"),
+			WithPragma("ut-database", Pragma{JournalMode: "wal"}))
+	})
+	rkentry.GlobalAppCtx.RemoveEntry(rkentry.GlobalAppCtx.GetEntry(SqliteEntryType, "ut-read-only-invalid"))
+
+	// YAML
+	bootConfigStr := `
+sqlite:
+  - name: ut-read-only-yaml
+    enabled: true
+    database:
+      - name: ut-database
+        readOnly: true
+      - name: ut-writable
+`
+	entries := RegisterSqliteEntryYAML([]byte(bootConfigStr))
+	yamlEntry := entries["ut-read-only-yaml"].(*SqliteEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(yamlEntry)
+	assert.True(t, yamlEntry.getInnerDb("ut-database").readOnly)
+	assert.False(t, yamlEntry.getInnerDb("ut-writable").readOnly)
+}
+
+func TestSqliteEntry_Pool(t *testing.T) {
+	dir := t.TempDir()
+	core, logs := observer.New(zap.InfoLevel)
+
+	entry := RegisterSqliteEntry(
+		WithName("ut-pool"),
+		WithLogger(&Logger{delegate: zap.New(core), LogLevel: gormLogger.Warn}),
+		WithDatabase("ut-default", dir, false, false),
+		WithDatabase("ut-override", dir, false, false),
+		WithMaxOpenConn("ut-override", 4),
+		WithMaxIdleConn("ut-override", 2),
+		WithConnMaxLifetime("ut-override", time.Minute),
+		WithDatabase("ut-unlimited", dir, false, false),
+		WithMaxOpenConn("ut-unlimited", -1),
+		WithDatabase("ut-memory", dir, false, true))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.Bootstrap(context.TODO())
+	defer entry.Interrupt(context.TODO())
+
+	for name, expected := range map[string]int{
+		"ut-default":   1,
+		"ut-override":  4,
+		"ut-unlimited": 0,
+		"ut-memory":    0,
+	} {
+		sqlDb, err := entry.GetDB(name).DB()
+		assert.Nil(t, err)
+		assert.Equal(t, expected, sqlDb.Stats().MaxOpenConnections, name)
+	}
+
+	// default is explained
+	assert.Equal(t, 1, logs.FilterMessage("Limit max open connections of database [ut-default] to 1 to prevent "+
+		"SQLITE_BUSY of concurrent writers, set maxOpenConn to override").Len())
+	assert.Equal(t, 1, logs.FilterMessageSnippet("Limit max open connections").Len())
+
+	// YAML
+	bootConfigStr := `
+sqlite:
+  - name: ut-pool-yaml
+    enabled: true
+    database:
+      - name: ut-database
+        maxOpenConn: 8
+        maxIdleConn: 4
+        connMaxLifetimeMs: 60000
+`
+	entries := RegisterSqliteEntryYAML([]byte(bootConfigStr))
+	yamlEntry := entries["ut-pool-yaml"].(*SqliteEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(yamlEntry)
+	inner := yamlEntry.getInnerDb("ut-database")
+	assert.Equal(t, 8, inner.maxOpenConn)
+	assert.Equal(t, 4, inner.maxIdleConn)
+	assert.Equal(t, time.Minute, inner.connMaxLifetime)
+}
+
+func TestSqliteEntry_ConcurrentWriters(t *testing.T) {
+	type utRecord struct {
+		Id    int `gorm:"primaryKey"`
+		Value int
+	}
+
+	entry := RegisterSqliteEntry(
+		WithName("ut-concurrent-writers"),
+		WithDatabase("ut-database", t.TempDir(), false, false))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.Bootstrap(context.TODO())
+	defer entry.Interrupt(context.TODO())
+
+	db := entry.GetDB("ut-database")
+	assert.Nil(t, db.AutoMigrate(&utRecord{}))
+
+	// inserts of goroutines are serialized by pool instead of failing with "database is locked"
+	writers, inserts := 8, 50
+	errCh := make(chan error, writers*inserts)
+	wg := sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for j := 0; j < inserts; j++ {
+				if err := db.Create(&utRecord{Value: writer*inserts + j}).Error; err != nil {
+					errCh <- err
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		assert.Nil(t, err)
+	}
+
+	var count int64
+	assert.Nil(t, db.Model(&utRecord{}).Count(&count).Error)
+	assert.Equal(t, int64(writers*inserts), count)
+}
+
 func assertNotPanic(t *testing.T) {
 	if r := recover(); r != nil {
 		// Expect panic to be called with non nil error
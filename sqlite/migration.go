@@ -0,0 +1,164 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rksqlite
+
+import (
+	"bufio"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// noTransactionDirective marks a migration file which could not run inside transaction,
+// for example, VACUUM
+const noTransactionDirective = "-- rk:no-transaction"
+
+// migrations is used to apply .sql files in dir, applied versions are recorded in table.
+// Files are read from dir of fsys if provided, for example, embed.FS, otherwise from dir on disk.
+type migrations struct {
+	dir   string
+	fsys  fs.FS
+	table string
+}
+
+// migrationFile is a .sql file whose version is file name without extension
+type migrationFile struct {
+	version string
+	path    string
+}
+
+// Apply .sql files in migration directory in order, each file will be applied exactly once.
+//
+// Statements of a file are executed at once, since driver executes multiple statements separated by semicolon.
+func (entry *SqliteEntry) migrate(innerDb *databaseInner, db *gorm.DB) error {
+	files, err := listMigrationFiles(innerDb.migrations)
+	if err != nil {
+		return fmt.Errorf("failed to list migrations of database %s, %w", innerDb.name, err)
+	}
+
+	table := quoteIdentifier(innerDb.migrations.table)
+	createTable := fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version TEXT NOT NULL PRIMARY KEY, applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)", table)
+	if res := db.Exec(createTable); res.Error != nil {
+		return fmt.Errorf("failed to create migration table %s, %w", innerDb.migrations.table, res.Error)
+	}
+
+	applied := make([]string, 0)
+	if res := db.Raw(fmt.Sprintf("SELECT version FROM %s", table)).Scan(&applied); res.Error != nil {
+		return fmt.Errorf("failed to list applied migrations, %w", res.Error)
+	}
+
+	appliedSet := make(map[string]bool)
+	for i := range applied {
+		appliedSet[applied[i]] = true
+	}
+
+	insert := fmt.Sprintf("INSERT INTO %s (version) VALUES (?)", table)
+	for _, file := range files {
+		if appliedSet[file.version] {
+			continue
+		}
+
+		content, err := innerDb.migrations.readFile(file.path)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s, %w", file.path, err)
+		}
+
+		apply := func(tx *gorm.DB) error {
+			if err := tx.Exec(string(content)).Error; err != nil {
+				return err
+			}
+			return tx.Exec(insert, file.version).Error
+		}
+
+		if isNoTransaction(string(content)) {
+			err = apply(db)
+		} else {
+			err = db.Transaction(apply)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %s to database %s, %w", file.path, innerDb.name, err)
+		}
+
+		entry.logger.delegate.Info(fmt.Sprintf("Applied migration [%s] to database [%s]", file.version, innerDb.name),
+			zap.String("file", file.path))
+	}
+
+	return nil
+}
+
+// Read file from fsys if provided, otherwise from disk
+func (m *migrations) readFile(name string) ([]byte, error) {
+	if m.fsys != nil {
+		return fs.ReadFile(m.fsys, name)
+	}
+
+	return os.ReadFile(name)
+}
+
+// List .sql files in dir ordered by file name
+func listMigrationFiles(m *migrations) ([]*migrationFile, error) {
+	var entries []fs.DirEntry
+	var err error
+	if m.fsys != nil {
+		entries, err = fs.ReadDir(m.fsys, m.dir)
+	} else {
+		entries, err = os.ReadDir(m.dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*migrationFile, 0)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+
+		res = append(res, &migrationFile{
+			version: strings.TrimSuffix(e.Name(), ".sql"),
+			path:    path.Join(m.dir, e.Name()),
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].version < res[j].version
+	})
+
+	return res, nil
+}
+
+// Check whether noTransactionDirective exists in leading comments
+func isNoTransaction(content string) bool {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 1 {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "--") {
+			return false
+		}
+
+		if line == noTransactionDirective {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Quote identifier with double quotes, embedded double quotes will be escaped
+func quoteIdentifier(in string) string {
+	return `"` + strings.ReplaceAll(in, `"`, `""`) + `"`
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+package rksqlite
+
+import (
+	"context"
+	"fmt"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path"
+	"testing"
+	"testing/fstest"
+)
+
+func TestListMigrationFiles(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(path.Join(dir, "002_add_index.sql"), []byte(""), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "001_init.sql"), []byte(""), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "README.md"), []byte(""), 0644))
+	assert.Nil(t, os.Mkdir(path.Join(dir, "003_dir.sql"), 0755))
+
+	files, err := listMigrationFiles(&migrations{dir: dir})
+	assert.Nil(t, err)
+	assert.Len(t, files, 2)
+	assert.Equal(t, "001_init", files[0].version)
+	assert.Equal(t, path.Join(dir, "001_init.sql"), files[0].path)
+	assert.Equal(t, "002_add_index", files[1].version)
+
+	// fs.FS
+	fsys := fstest.MapFS{
+		"migrations/002_add_index.sql": {Data: []byte("")},
+		"migrations/001_init.sql":      {Data: []byte("")},
+		"migrations/README.md":         {Data: []byte("")},
+	}
+	files, err = listMigrationFiles(&migrations{dir: "migrations", fsys: fsys})
+	assert.Nil(t, err)
+	assert.Len(t, files, 2)
+	assert.Equal(t, "001_init", files[0].version)
+	assert.Equal(t, "migrations/001_init.sql", files[0].path)
+	assert.Equal(t, "002_add_index", files[1].version)
+
+	// missing directory
+	_, err = listMigrationFiles(&migrations{dir: path.Join(dir, "not-exist")})
+	assert.NotNil(t, err)
+	_, err = listMigrationFiles(&migrations{dir: "not-exist", fsys: fsys})
+	assert.NotNil(t, err)
+}
+
+func TestIsNoTransaction(t *testing.T) {
+	assert.False(t, isNoTransaction("CREATE TABLE t (id INT);"))
+	assert.True(t, isNoTransaction("-- compact\n\n-- rk:no-transaction\nVACUUM;"))
+	assert.False(t, isNoTransaction("VACUUM;\n-- rk:no-transaction"))
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	assert.Equal(t, `"schema_migrations"`, quoteIdentifier("schema_migrations"))
+	assert.Equal(t, `"ut""table"`, quoteIdentifier(`ut"table`))
+}
+
+func TestSqliteEntry_Migrate(t *testing.T) {
+	dir := t.TempDir()
+	migrationDir := path.Join(dir, "migrations")
+	assert.Nil(t, os.Mkdir(migrationDir, 0755))
+	assert.Nil(t, os.WriteFile(path.Join(migrationDir, "001_init.sql"),
+		[]byte("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);\nINSERT INTO users (name) VALUES ('ut');"), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(migrationDir, "002_add_email.sql"),
+		[]byte("ALTER TABLE users ADD COLUMN email TEXT;"), 0644))
+
+	bootstrap := func(name string) *SqliteEntry {
+		entry := RegisterSqliteEntry(
+			WithName(name),
+			WithDatabase("ut-database", dir, false, false),
+			WithMigrations("ut-database", migrationDir, "ut_versions"))
+		entry.Bootstrap(context.TODO())
+		return entry
+	}
+
+	// apply in order
+	entry := bootstrap("ut-migrate")
+	db := entry.GetDB("ut-database")
+	versions := make([]string, 0)
+	assert.Nil(t, db.Raw(`SELECT version FROM "ut_versions" ORDER BY version`).Scan(&versions).Error)
+	assert.Equal(t, []string{"001_init", "002_add_email"}, versions)
+	assert.Nil(t, db.Exec("UPDATE users SET email = 'ut@example.com'").Error)
+	entry.Interrupt(context.TODO())
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// applied exactly once, failed migration is rolled back
+	assert.Nil(t, os.WriteFile(path.Join(migrationDir, "003_broken.sql"),
+		[]byte("CREATE TABLE orders (id INTEGER PRIMARY KEY);\nINSERT INTO missing (id) VALUES (1);"), 0644))
+	entry = RegisterSqliteEntry(
+		WithName("ut-migrate-broken"),
+		WithDatabase("ut-database", dir, false, false),
+		WithMigrations("ut-database", migrationDir, "ut_versions"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	err := entry.connect()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("failed to apply migration %s to database ut-database",
+		path.Join(migrationDir, "003_broken.sql")))
+
+	// bootstrap fails with file name
+	assert.PanicsWithError(t, "failed to connect to database, "+err.Error(), func() {
+		entry.Bootstrap(context.TODO())
+	})
+	assert.Nil(t, os.Remove(path.Join(migrationDir, "003_broken.sql")))
+
+	entry = bootstrap("ut-migrate-again")
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	defer entry.Interrupt(context.TODO())
+	db = entry.GetDB("ut-database")
+	var count int64
+	assert.Nil(t, db.Raw("SELECT count(*) FROM users").Scan(&count).Error)
+	assert.Equal(t, int64(1), count)
+	assert.False(t, db.Migrator().HasTable("orders"))
+	assert.Nil(t, db.Raw(`SELECT count(*) FROM "ut_versions"`).Scan(&count).Error)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestSqliteEntry_MigrateFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/001_init.sql":   {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY);")},
+		"sql/002_vacuum.sql": {Data: []byte("-- rk:no-transaction\nVACUUM;")},
+	}
+
+	entry := RegisterSqliteEntry(
+		WithName("ut-migrate-fs"),
+		WithDatabase("ut-database", t.TempDir(), false, false),
+		WithMigrationsFS("ut-database", fsys, "sql", ""))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.Bootstrap(context.TODO())
+	defer entry.Interrupt(context.TODO())
+
+	db := entry.GetDB("ut-database")
+	assert.True(t, db.Migrator().HasTable("users"))
+	versions := make([]string, 0)
+	assert.Nil(t, db.Raw(`SELECT version FROM "schema_migrations" ORDER BY version`).Scan(&versions).Error)
+	assert.Equal(t, []string{"001_init", "002_vacuum"}, versions)
+}
+
+func TestSqliteEntry_MigrateDryRun(t *testing.T) {
+	dir := t.TempDir()
+	fsys := fstest.MapFS{
+		"001_init.sql": {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY);")},
+	}
+
+	entry := RegisterSqliteEntry(
+		WithName("ut-migrate-dry-run"),
+		WithDatabase("ut-database", dir, true, false),
+		WithMigrationsFS("ut-database", fsys, "", ""))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.Bootstrap(context.TODO())
+	entry.Interrupt(context.TODO())
+
+	// nothing is executed
+	entry = RegisterSqliteEntry(
+		WithName("ut-migrate-dry-run-check"),
+		WithDatabase("ut-database", dir, false, false))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.Bootstrap(context.TODO())
+	defer entry.Interrupt(context.TODO())
+	assert.False(t, entry.GetDB("ut-database").Migrator().HasTable("schema_migrations"))
+	assert.False(t, entry.GetDB("ut-database").Migrator().HasTable("users"))
+}
+
+func TestRegisterSqliteEntry_Migrations(t *testing.T) {
+	bootConfigStr := `
+sqlite:
+  - name: ut-entry
+    enabled: true
+    database:
+      - name: ut-default
+        migrations:
+          dir: migrations
+      - name: ut-custom
+        migrations:
+          dir: /ut/migrations
+          table: ut_versions
+      - name: ut-none
+`
+
+	entries := RegisterSqliteEntryYAML([]byte(bootConfigStr))
+	assert.NotEmpty(t, entries)
+
+	entry := GetSqliteEntry("ut-entry")
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	wd, _ := os.Getwd()
+	assert.Equal(t, &migrations{dir: path.Join(wd, "migrations"), table: "schema_migrations"}, entry.innerDbList[0].migrations)
+	assert.Equal(t, &migrations{dir: "/ut/migrations", table: "ut_versions"}, entry.innerDbList[1].migrations)
+	assert.Nil(t, entry.innerDbList[2].migrations)
+
+	// read-only database
+	assert.PanicsWithError(t, "migrations could not be applied to read-only database ut-database", func() {
+		RegisterSqliteEntry(
+			WithName("ut-migrations-read-only"),
+			WithDatabase("ut-database", "", false, false),
+			WithReadOnly("ut-database"),
+			WithMigrations("ut-database", "migrations", ""))
+	})
+}
@@ -86,7 +86,7 @@ func (l *Logger) Error(ctx context.Context, msg string, data ...interface{}) {
 	logger = logger.WithOptions(zap.AddCallerSkip(linesToSkip(fileStack)))
 
 	if l.LogLevel >= gormLogger.Error {
-		logger.Warn(fmt.Sprintf(msg, data...))
+		logger.Error(fmt.Sprintf(msg, data...))
 	}
 }
 
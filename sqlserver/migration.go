@@ -0,0 +1,233 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rksqlserver
+
+import (
+	"bufio"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// noTransactionDirective marks a migration file which should not run inside transaction
+const noTransactionDirective = "-- rk:no-transaction"
+
+// migrations is used to apply .sql files in dir, applied versions are recorded in table
+type migrations struct {
+	dir   string
+	table string
+}
+
+// migrationFile is a .sql file whose version is file name without extension
+type migrationFile struct {
+	version string
+	path    string
+}
+
+// Apply .sql files in migration directory in order, each file will be applied exactly once.
+//
+// Batches in file are split by GO separator as sqlcmd and SSMS do, since statements like CREATE PROCEDURE
+// must be the first statement of a batch. All batches of a file are applied in one transaction,
+// unless -- rk:no-transaction is placed in leading comments of file.
+func (entry *SqlServerEntry) migrate(innerDb *databaseInner, db *gorm.DB) error {
+	files, err := listMigrationFiles(innerDb.migrations.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list migrations of database %s, %w", innerDb.name, err)
+	}
+
+	if res := db.Exec(toCreateMigrationTableSql(innerDb.migrations.table)); res.Error != nil {
+		return fmt.Errorf("failed to create migration table %s, %w", innerDb.migrations.table, res.Error)
+	}
+
+	table := quoteIdentifier(innerDb.migrations.table)
+	applied := make([]string, 0)
+	if res := db.Raw(fmt.Sprintf("SELECT version FROM %s", table)).Scan(&applied); res.Error != nil {
+		return fmt.Errorf("failed to list applied migrations, %w", res.Error)
+	}
+
+	appliedSet := make(map[string]bool)
+	for i := range applied {
+		appliedSet[applied[i]] = true
+	}
+
+	insert := fmt.Sprintf("INSERT INTO %s (version) VALUES (?)", table)
+	for _, file := range files {
+		if appliedSet[file.version] {
+			continue
+		}
+
+		content, err := os.ReadFile(file.path)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s, %w", file.path, err)
+		}
+
+		apply := func(tx *gorm.DB) error {
+			for _, batch := range splitBatches(string(content)) {
+				if err := tx.Exec(batch).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Exec(insert, file.version).Error
+		}
+
+		if isNoTransaction(string(content)) {
+			err = apply(db)
+		} else {
+			err = db.Transaction(apply)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %s to database %s, %w", file.path, innerDb.name, err)
+		}
+
+		entry.logger.delegate.Info(fmt.Sprintf("Applied migration [%s] to database [%s]", file.version, innerDb.name),
+			zap.String("file", file.path))
+	}
+
+	return nil
+}
+
+// Returns statement which creates migration table if missing
+func toCreateMigrationTableSql(table string) string {
+	return fmt.Sprintf(
+		"IF OBJECT_ID(N'%s', N'U') IS NULL CREATE TABLE %s (version NVARCHAR(255) NOT NULL PRIMARY KEY, applied_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME())",
+		strings.ReplaceAll(quoteIdentifier(table), "'", "''"), quoteIdentifier(table))
+}
+
+// List .sql files in dir ordered by file name
+func listMigrationFiles(dir string) ([]*migrationFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*migrationFile, 0)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+
+		res = append(res, &migrationFile{
+			version: strings.TrimSuffix(e.Name(), ".sql"),
+			path:    path.Join(dir, e.Name()),
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].version < res[j].version
+	})
+
+	return res, nil
+}
+
+// Check whether noTransactionDirective exists in leading comments
+func isNoTransaction(content string) bool {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 1 {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "--") {
+			return false
+		}
+
+		if line == noTransactionDirective {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Split content into batches by lines which contain only GO separator (case-insensitive), blank batches are dropped.
+// Repeat count of sqlcmd like GO 5 is not supported.
+func splitBatches(content string) []string {
+	res := make([]string, 0)
+	current := strings.Builder{}
+
+	appendBatch := func() {
+		if batch := strings.TrimSpace(current.String()); len(batch) > 0 {
+			res = append(res, batch)
+		}
+		current.Reset()
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if strings.EqualFold(strings.TrimSpace(line), "GO") {
+			appendBatch()
+			continue
+		}
+
+		current.WriteString(strings.TrimRight(line, "\r"))
+		current.WriteByte('\n')
+	}
+
+	appendBatch()
+
+	return res
+}
+
+// seedOptions is used to load data into database created by autoCreate
+type seedOptions struct {
+	script string
+	sql    []string
+	fatal  bool
+}
+
+// Execute batches of seed script and statements in one transaction.
+//
+// Batches are split by GO separator as migrations, and transaction is skipped if -- rk:no-transaction
+// is placed in leading comments of seed script, since statements like CREATE LOGIN could not run inside transaction.
+func (entry *SqlServerEntry) seedDatabase(innerDb *databaseInner, db *gorm.DB) error {
+	batches := make([]string, 0)
+	noTransaction := false
+	if len(innerDb.seed.script) > 0 {
+		content, err := os.ReadFile(innerDb.seed.script)
+		if err != nil {
+			return fmt.Errorf("failed to read seed script %s, %w", innerDb.seed.script, err)
+		}
+		batches = append(batches, splitBatches(string(content))...)
+		noTransaction = isNoTransaction(string(content))
+	}
+	for i := range innerDb.seed.sql {
+		batches = append(batches, splitBatches(innerDb.seed.sql[i])...)
+	}
+
+	var rows int64
+	apply := func(tx *gorm.DB) error {
+		for i := range batches {
+			res := tx.Exec(batches[i])
+			if res.Error != nil {
+				return res.Error
+			}
+			rows += res.RowsAffected
+		}
+		return nil
+	}
+
+	var err error
+	if noTransaction {
+		err = apply(db)
+	} else {
+		err = db.Transaction(apply)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to seed database %s, %w", innerDb.name, err)
+	}
+
+	entry.logger.delegate.Info(fmt.Sprintf("Seeded database [%s]", innerDb.name),
+		zap.Int("statements", len(batches)),
+		zap.Int64("rowsAffected", rows))
+
+	return nil
+}
@@ -0,0 +1,263 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+package rksqlserver
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestListMigrationFiles(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(path.Join(dir, "002_add_index.sql"), []byte(""), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "001_init.sql"), []byte(""), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "README.md"), []byte(""), 0644))
+	assert.Nil(t, os.Mkdir(path.Join(dir, "003_dir.sql"), 0755))
+
+	files, err := listMigrationFiles(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 2)
+	assert.Equal(t, "001_init", files[0].version)
+	assert.Equal(t, path.Join(dir, "001_init.sql"), files[0].path)
+	assert.Equal(t, "002_add_index", files[1].version)
+
+	// missing directory
+	_, err = listMigrationFiles(path.Join(dir, "not-exist"))
+	assert.NotNil(t, err)
+}
+
+func TestIsNoTransaction(t *testing.T) {
+	assert.False(t, isNoTransaction("CREATE TABLE t (id INT);"))
+	assert.True(t, isNoTransaction("-- create table\n\n-- rk:no-transaction\nCREATE TABLE t (id INT);"))
+	assert.False(t, isNoTransaction("CREATE TABLE t (id INT);\n-- rk:no-transaction"))
+}
+
+func TestSplitBatches(t *testing.T) {
+	// empty
+	assert.Empty(t, splitBatches(""))
+	assert.Empty(t, splitBatches("GO\n  go  \n\nGO"))
+
+	// single batch without separator
+	assert.Equal(t,
+		[]string{"CREATE TABLE t (id INT);\nINSERT INTO t VALUES (1);"},
+		splitBatches("CREATE TABLE t (id INT);\nINSERT INTO t VALUES (1);\n"))
+
+	// separator is case-insensitive and CRLF is supported
+	assert.Equal(t,
+		[]string{"CREATE TABLE t (id INT);", "CREATE PROCEDURE p AS SELECT * FROM t;", "EXEC p;"},
+		splitBatches("CREATE TABLE t (id INT);\r\nGO\r\nCREATE PROCEDURE p AS SELECT * FROM t;\r\n\tgo\r\nEXEC p;\r\nGo"))
+
+	// GO in statement is not separator
+	assert.Equal(t,
+		[]string{"SELECT 'GO' AS go\nFROM t GO"},
+		splitBatches("SELECT 'GO' AS go\nFROM t GO"))
+}
+
+func TestRegisterSqlServerEntry_Migrations(t *testing.T) {
+	bootConfigStr := `
+sqlserver:
+  - name: ut-migrations
+    enabled: true
+    database:
+      - name: ut-default
+        migrations:
+          dir: migrations
+      - name: ut-custom
+        migrations:
+          dir: /ut/migrations
+          table: ut_versions
+      - name: ut-none
+`
+
+	entries := RegisterSqlServerEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-migrations"].(*SqlServerEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	wd, _ := os.Getwd()
+	assert.Equal(t, &migrations{dir: path.Join(wd, "migrations"), table: "schema_migrations"}, entry.innerDbList[0].migrations)
+	assert.Equal(t, &migrations{dir: "/ut/migrations", table: "ut_versions"}, entry.innerDbList[1].migrations)
+	assert.Nil(t, entry.innerDbList[2].migrations)
+
+	// by option
+	entry = RegisterSqlServerEntry(
+		WithName("ut-migrations-option"),
+		WithDatabase("ut-database", false, false),
+		WithMigrations("ut-database", "/ut/migrations", ""),
+		WithMigrations("ut-missing", "/ut/migrations", ""))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.Equal(t, &migrations{dir: "/ut/migrations", table: "schema_migrations"}, entry.innerDbList[0].migrations)
+}
+
+func TestSqlServerEntry_Migrate(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(path.Join(dir, "001_init.sql"),
+		[]byte("CREATE TABLE users (id INT)\nGO\nCREATE PROCEDURE list_users AS SELECT * FROM users\nGO\n"), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "002_index.sql"),
+		[]byte("-- rk:no-transaction\nCREATE INDEX idx_id ON users (id)"), 0644))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "003_broken.sql"),
+		[]byte("ALTER TABLE users ADD"), 0644))
+
+	sqlDb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.Nil(t, err)
+	defer sqlDb.Close()
+
+	db, err := gorm.Open(sqlserver.New(sqlserver.Config{Conn: sqlDb}), &gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err)
+
+	entry := RegisterSqlServerEntry(
+		WithName("ut-migrate"),
+		WithDatabase("ut-database", false, false),
+		WithMigrations("ut-database", dir, "ut_versions"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	core, logs := observer.New(zap.InfoLevel)
+	entry.logger = &Logger{delegate: zap.New(core)}
+	innerDb := entry.getInnerDb("ut-database")
+
+	assert.Equal(t,
+		"IF OBJECT_ID(N'[ut_versions]', N'U') IS NULL CREATE TABLE [ut_versions] (version NVARCHAR(255) NOT NULL PRIMARY KEY, applied_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME())",
+		toCreateMigrationTableSql("ut_versions"))
+
+	// 001 is applied already, 002 runs without transaction and 003 fails
+	mock.ExpectExec(toCreateMigrationTableSql("ut_versions")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version FROM [ut_versions]").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("001_init"))
+	mock.ExpectExec("-- rk:no-transaction\nCREATE INDEX idx_id ON users (id)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO [ut_versions] (version) VALUES (@p1)").
+		WithArgs("002_index").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("ALTER TABLE users ADD").WillReturnError(errors.New("incorrect syntax"))
+	mock.ExpectRollback()
+
+	err = entry.migrate(innerDb, db)
+	assert.EqualError(t, err,
+		"failed to apply migration "+path.Join(dir, "003_broken.sql")+" to database ut-database, incorrect syntax")
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Len(t, logs.FilterMessage("Applied migration [002_index] to database [ut-database]").All(), 1)
+
+	// each batch of file is executed in one transaction
+	assert.Nil(t, os.Remove(path.Join(dir, "003_broken.sql")))
+	mock.ExpectExec(toCreateMigrationTableSql("ut_versions")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version FROM [ut_versions]").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("002_index"))
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE users (id INT)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE PROCEDURE list_users AS SELECT * FROM users").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO [ut_versions] (version) VALUES (@p1)").
+		WithArgs("001_init").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, entry.migrate(innerDb, db))
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	// missing directory
+	innerDb.migrations.dir = path.Join(dir, "not-exist")
+	assert.NotNil(t, entry.migrate(innerDb, db))
+}
+
+func TestRegisterSqlServerEntry_Seed(t *testing.T) {
+	bootConfigStr := `
+sqlserver:
+  - name: ut-seed
+    enabled: true
+    database:
+      - name: ut-fatal
+        autoCreate: true
+        seedScript: seed/user.sql
+        seedSQL:
+          - INSERT INTO role (name) VALUES ('admin')
+      - name: ut-warn
+        autoCreate: true
+        seedSQL:
+          - INSERT INTO role (name) VALUES ('admin')
+        seedOnError: WARN
+      - name: ut-none
+`
+
+	entries := RegisterSqlServerEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-seed"].(*SqlServerEntry)
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	wd, _ := os.Getwd()
+	assert.Equal(t, &seedOptions{
+		script: path.Join(wd, "seed/user.sql"),
+		sql:    []string{"INSERT INTO role (name) VALUES ('admin')"},
+		fatal:  true,
+	}, entry.innerDbList[0].seed)
+	assert.False(t, entry.innerDbList[1].seed.fatal)
+	assert.Empty(t, entry.innerDbList[1].seed.script)
+	assert.Nil(t, entry.innerDbList[2].seed)
+}
+
+func TestSqlServerEntry_SeedDatabase(t *testing.T) {
+	dir := t.TempDir()
+	script := path.Join(dir, "seed.sql")
+	assert.Nil(t, os.WriteFile(script,
+		[]byte("CREATE ROLE reader\nGO\nINSERT INTO role (name) VALUES ('admin'), ('guest')\nGO\n"), 0644))
+
+	sqlDb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.Nil(t, err)
+	defer sqlDb.Close()
+
+	db, err := gorm.Open(sqlserver.New(sqlserver.Config{Conn: sqlDb}), &gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err)
+
+	entry := RegisterSqlServerEntry(
+		WithName("ut-seed-database"),
+		WithDatabase("ut-database", false, true),
+		WithSeed("ut-database", script, []string{"INSERT INTO config (k) VALUES ('a')\nGO\nEXEC init_config"}, true))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	core, logs := observer.New(zap.InfoLevel)
+	entry.logger = &Logger{delegate: zap.New(core)}
+	innerDb := entry.getInnerDb("ut-database")
+
+	// script and statements are executed in one transaction
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE ROLE reader").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO role (name) VALUES ('admin'), ('guest')").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO config (k) VALUES ('a')").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("EXEC init_config").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	assert.Nil(t, entry.seedDatabase(innerDb, db))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	seeded := logs.FilterMessage("Seeded database [ut-database]").All()
+	assert.Len(t, seeded, 1)
+	assert.Equal(t, int64(4), seeded[0].ContextMap()["statements"])
+	assert.Equal(t, int64(3), seeded[0].ContextMap()["rowsAffected"])
+
+	// rolled back while failed
+	innerDb.seed.script = ""
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO config (k) VALUES ('a')").WillReturnError(errors.New("duplicate key"))
+	mock.ExpectRollback()
+
+	assert.EqualError(t, entry.seedDatabase(innerDb, db), "failed to seed database ut-database, duplicate key")
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	// without transaction
+	assert.Nil(t, os.WriteFile(script,
+		[]byte("-- rk:no-transaction\nCREATE LOGIN reader WITH PASSWORD = 'p'"), 0644))
+	innerDb.seed = &seedOptions{script: script}
+	mock.ExpectExec("-- rk:no-transaction\nCREATE LOGIN reader WITH PASSWORD = 'p'").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, entry.seedDatabase(innerDb, db))
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	// missing script
+	innerDb.seed.script = path.Join(dir, "not-exist.sql")
+	assert.NotNil(t, entry.seedDatabase(innerDb, db))
+}
@@ -35,6 +35,10 @@ func NewProm(conf *PromConfig) *Prom {
 
 const (
 	startTimeKey = "rk-startTime"
+	// tableUnknown is label value of raw statements whose table could not be parsed
+	tableUnknown = "unknown"
+	// only leading bytes of raw statement will be parsed
+	maxRawSqlLen = 1024
 )
 
 type PromConfig struct {
@@ -42,6 +46,8 @@ type PromConfig struct {
 	DbAddr  string `yaml:"-" json:"-"`
 	DbName  string `yaml:"-" json:"-"`
 	DbType  string `yaml:"-" json:"-"`
+	// parse table of db.Raw and db.Exec statements from SQL, since db.Statement.Table is empty for them
+	ParseRawTable bool `yaml:"parseRawTable" json:"parseRawTable"`
 }
 
 type Prom struct {
@@ -74,10 +80,15 @@ func (p *Prom) after(action string) func(db *gorm.DB) {
 
 		elapsed := time.Now().Sub(endTime).Nanoseconds()
 
+		table := db.Statement.Table
+		if action == "raw" && len(table) < 1 && p.Conf.ParseRawTable {
+			table = parseRawTable(db.Statement.SQL.String())
+		}
+
 		labelValues := []string{
 			p.Conf.DbName,
 			p.Conf.DbAddr,
-			db.Statement.Table,
+			table,
 			action,
 		}
 
@@ -139,3 +150,114 @@ func (p *Prom) Initialize(db *gorm.DB) error {
 
 	return nil
 }
+
+// Returns first table after FROM, INTO, UPDATE, JOIN or DELETE in statement, unknown will be returned if missing.
+//
+// It is best-effort, only the first maxRawSqlLen bytes are parsed, string literals and comments are skipped,
+// and brackets and double quotes around identifiers are removed, like [dbo].[users] is returned as dbo.users.
+func parseRawTable(sql string) string {
+	if len(sql) > maxRawSqlLen {
+		sql = sql[:maxRawSqlLen]
+	}
+
+	expectTable := false
+	for _, token := range tokenizeSql(sql) {
+		switch {
+		case isTableKeyword(token):
+			// keyword could follow another one, like DELETE FROM
+			expectTable = true
+		case !expectTable:
+			// neither keyword nor table
+		case token == "(":
+			// derived table, parse tables in subquery
+			expectTable = false
+		default:
+			return strings.NewReplacer("[", "", "]", "", `"`, "").Replace(token)
+		}
+	}
+
+	return tableUnknown
+}
+
+// Check whether token is followed by table
+func isTableKeyword(token string) bool {
+	for _, keyword := range []string{"FROM", "INTO", "UPDATE", "JOIN", "DELETE"} {
+		if strings.EqualFold(token, keyword) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Split statement into identifiers and opening parentheses, other characters are treated as separators
+func tokenizeSql(sql string) []string {
+	res := make([]string, 0)
+	current := strings.Builder{}
+
+	appendToken := func() {
+		if current.Len() > 0 {
+			res = append(res, current.String())
+			current.Reset()
+		}
+	}
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+
+		switch {
+		// string literal
+		case c == '\'':
+			appendToken()
+			for i++; i < len(sql); i++ {
+				if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+		// line comment
+		case strings.HasPrefix(sql[i:], "--"):
+			appendToken()
+			if j := strings.IndexByte(sql[i:], '\n'); j >= 0 {
+				i += j
+			} else {
+				i = len(sql)
+			}
+		// block comment
+		case strings.HasPrefix(sql[i:], "/*"):
+			appendToken()
+			if j := strings.Index(sql[i+2:], "*/"); j >= 0 {
+				i += j + 3
+			} else {
+				i = len(sql)
+			}
+		// quoted identifier
+		case c == '[' || c == '"':
+			end := byte(']')
+			if c == '"' {
+				end = '"'
+			}
+			j := strings.IndexByte(sql[i+1:], end)
+			if j < 0 {
+				j = len(sql) - i - 2
+			}
+			current.WriteString(sql[i : i+j+2])
+			i += j + 1
+		case c == '(':
+			appendToken()
+			res = append(res, "(")
+		case c == '_' || c == '.' || c == '@' || c == '#' || c == '$' ||
+			(c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80:
+			current.WriteByte(c)
+		default:
+			appendToken()
+		}
+	}
+
+	appendToken()
+
+	return res
+}
@@ -0,0 +1,91 @@
+package plugins
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRawTable(t *testing.T) {
+	// select
+	assert.Equal(t, "users", parseRawTable("SELECT * FROM users WHERE id = @p1"))
+	assert.Equal(t, "dbo.users", parseRawTable("SELECT u.id FROM [dbo].[users] u JOIN orders o ON u.id = o.user_id"))
+	assert.Equal(t, "users", parseRawTable(`select count(*) from "users"`))
+	assert.Equal(t, "users", parseRawTable("SELECT * FROM (SELECT id FROM users) AS t"))
+	assert.Equal(t, "user orders", parseRawTable("SELECT * FROM [user orders]"))
+
+	// insert, update and delete
+	assert.Equal(t, "users", parseRawTable("INSERT INTO users (id, name) VALUES (@p1, @p2)"))
+	assert.Equal(t, "users", parseRawTable("UPDATE users SET name = @p1 WHERE id = @p2"))
+	assert.Equal(t, "users", parseRawTable("DELETE FROM users WHERE id = @p1"))
+	assert.Equal(t, "users", parseRawTable("DELETE users WHERE id = @p1"))
+
+	// weird whitespace and comments
+	assert.Equal(t, "users", parseRawTable("\n\tSELECT\t*\r\n  FROM\n\n\tusers\r\n"))
+	assert.Equal(t, "users", parseRawTable("SELECT * FROM/* comment */users"))
+	assert.Equal(t, "users", parseRawTable("-- FROM comments\nSELECT * FROM users"))
+	assert.Equal(t, "users", parseRawTable("SELECT 'FROM strings', 'it''s' FROM users"))
+	assert.Equal(t, "users", parseRawTable("SELECT*FROM users"))
+
+	// unknown
+	assert.Equal(t, "unknown", parseRawTable(""))
+	assert.Equal(t, "unknown", parseRawTable("SELECT 1"))
+	assert.Equal(t, "unknown", parseRawTable("EXEC sp_who"))
+	assert.Equal(t, "unknown", parseRawTable("SELECT * FROM"))
+	assert.Equal(t, "unknown", parseRawTable("SELECT 'unterminated FROM users"))
+
+	// bounded
+	assert.Equal(t, "unknown", parseRawTable("SELECT "+strings.Repeat("a, ", maxRawSqlLen)+"b FROM users"))
+}
+
+func TestProm_RawTableLabel(t *testing.T) {
+	prom := NewProm(&PromConfig{
+		Enabled: true,
+		DbAddr:  "localhost:1433",
+		DbName:  "ut-database",
+		DbType:  "ut-sqlserver",
+	})
+	defer prom.MetricsSet.UnRegisterCounter("error")
+	defer prom.MetricsSet.UnRegisterCounter("rowsAffected")
+	defer prom.MetricsSet.UnRegisterSummary("elapsedNano")
+
+	exec := func(action, table, sql string) {
+		db := &gorm.DB{}
+		db.Statement = &gorm.Statement{
+			DB:      db,
+			Context: context.WithValue(context.TODO(), startTimeKey, time.Now()),
+			Table:   table,
+		}
+		db.Statement.RowsAffected = 1
+		db.Statement.SQL.WriteString(sql)
+		prom.after(action)(db)
+	}
+
+	counter := prom.MetricsSet.GetCounter("rowsAffected")
+
+	// disabled by default
+	exec("raw", "", "UPDATE users SET name = @p1")
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(counter.WithLabelValues("ut-database", "localhost:1433", "", "raw")))
+
+	// enabled
+	prom.Conf.ParseRawTable = true
+	exec("raw", "", "UPDATE users SET name = @p1")
+	exec("raw", "", "SELECT 1")
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(counter.WithLabelValues("ut-database", "localhost:1433", "users", "raw")))
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(counter.WithLabelValues("ut-database", "localhost:1433", "unknown", "raw")))
+
+	// table of statement wins, and only raw statements are parsed
+	exec("raw", "orders", "UPDATE users SET name = @p1")
+	exec("update", "", "UPDATE users SET name = @p1")
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(counter.WithLabelValues("ut-database", "localhost:1433", "orders", "raw")))
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(counter.WithLabelValues("ut-database", "localhost:1433", "", "update")))
+}